@@ -0,0 +1,218 @@
+package zml
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"strings"
+)
+
+const (
+	laneHeaderHeight = elemenetBoxHeight
+	lanePadding      = 20.0
+	circleRadius     = 12.0
+	barHeight        = 6.0
+	barWidth         = 120.0
+)
+
+var activityNodeTypes = map[string]int{
+	"start":    CIRCLE,
+	"end":      FINAL,
+	"action":   RECT,
+	"decision": DECISION,
+	"fork":     BAR,
+	"join":     BAR,
+}
+
+// AddLaneNode adds a node to the swimlane `lane` of an activity diagram;
+// lanes are created as needed, in order of appearance
+func (dia *Diagram) AddLaneNode(lane, id, label string, nodeType int) error {
+	if lane == "" {
+		return fmt.Errorf("node \"%s\" has no lane", id)
+	}
+	if nodeType == CIRCLE || nodeType == FINAL || nodeType == BAR {
+		// only actions and decisions carry text
+		if label == "" {
+			label = " "
+		}
+	}
+	dia.AddElemenets(lane)
+	if err := dia.AddNode(id, label, nodeType, ""); err != nil {
+		return err
+	}
+	dia.nodes[id].Lane = lane
+	return nil
+}
+
+// processActivity parses the body of an activity diagram; nodes belong to
+// the last `lane` line above them:
+//
+//	lane Customer
+//	    start begin
+//	    action order: Place order
+//	lane Shop
+//	    decision stock: In stock?
+//	begin -> order
+//	order -> stock
+func (dia *Diagram) processActivity(lines []string) {
+	laneRegexp := regexp.MustCompile(`^lane\s+(.+)$`)
+	nodeRegexp := regexp.MustCompile(`^(start|end|action|decision|fork|join)\s+([\w.-]+)\s*(?::\s*(.*))?$`)
+
+	lane := ""
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//") {
+			continue
+		}
+		if parts := laneRegexp.FindStringSubmatch(line); parts != nil {
+			lane = strings.TrimSpace(parts[1])
+			dia.AddElemenets(lane)
+			continue
+		}
+		if parts := nodeRegexp.FindStringSubmatch(line); parts != nil {
+			if err := dia.AddLaneNode(lane, parts[2], strings.TrimSpace(parts[3]), activityNodeTypes[parts[1]]); err != nil {
+				log.Printf(err.Error())
+			}
+			continue
+		}
+		if !dia.processLink(line) {
+			log.Printf("unrecognised line: %s", line)
+		}
+	}
+}
+
+// sizeActivityNode sets the width and height of `n` from its shape and label
+func (dia *Diagram) sizeActivityNode(n *node) {
+	switch n.Type {
+	case CIRCLE, FINAL:
+		n.w, n.h = 2*circleRadius, 2*circleRadius
+	case BAR:
+		n.w, n.h = barWidth, barHeight
+	case DECISION:
+		n.w = dia.decisionSize(n.Label)
+		n.h = n.w
+	default:
+		strWidth, strHeight := dia.measureText(n.Label)
+		n.w = math.Max(elemenetBoxWidth, strWidth+elemenetsPadding)
+		n.h = math.Max(elemenetBoxHeight, strHeight+elemenetsPadding)
+	}
+}
+
+// layoutActivity puts each node in its lane column and in the row of its rank
+func (dia *Diagram) layoutActivity() (float64, float64) {
+	top := dia.top()
+	dia.useFont(dia.themedElementFont())
+	_, lineHeight := dia.measureRuns(nil)
+	laneIndex := make(map[string]int, len(dia.elemenets))
+	laneWidths := make([]float64, len(dia.elemenets))
+	dia.headerHeight = laneHeaderHeight
+	for i, lane := range dia.elemenets {
+		laneIndex[lane.Name] = i
+		strWidth, strHeight := dia.measureText(lane.Name)
+		laneWidths[i] = math.Max(elemenetBoxWidth, strWidth+elemenetsPadding)
+		dia.headerHeight = math.Max(dia.headerHeight, laneHeaderHeight+strHeight-lineHeight)
+	}
+
+	ranks := dia.rankChildren(dia.root)
+	rowHeights := make([]float64, len(ranks))
+	for r, members := range ranks {
+		rowWidths := make([]float64, len(dia.elemenets))
+		for _, n := range members {
+			dia.sizeActivityNode(n)
+			rowHeights[r] = math.Max(rowHeights[r], n.h)
+			if rowWidths[laneIndex[n.Lane]] > 0 {
+				rowWidths[laneIndex[n.Lane]] += nodeSpacing
+			}
+			rowWidths[laneIndex[n.Lane]] += n.w
+		}
+		for i := range laneWidths {
+			laneWidths[i] = math.Max(laneWidths[i], rowWidths[i])
+		}
+	}
+
+	totalWidth := 0.0
+	for i := range laneWidths {
+		laneWidths[i] += 2 * lanePadding
+		totalWidth += laneWidths[i]
+	}
+	marginX := math.Max(elemenetsPadding, (float64(dia.dc.Width())-totalWidth)/2)
+	laneX := make([]float64, len(laneWidths))
+	for i := range laneWidths {
+		laneX[i] = marginX
+		if i > 0 {
+			laneX[i] = laneX[i-1] + laneWidths[i-1]
+		}
+		dia.elemenetsCoordMap[dia.elemenets[i].Name] = elemenetCoord{X: laneX[i], Y: top}
+	}
+
+	rowY := top + dia.headerHeight + rankSpacing/2
+	for r, members := range ranks {
+		// nodes sharing a lane and a row sit side by side, centered in the lane
+		for i := range dia.elemenets {
+			var cell []*node
+			cellWidth := -nodeSpacing
+			for _, n := range members {
+				if laneIndex[n.Lane] == i {
+					cell = append(cell, n)
+					cellWidth += n.w + nodeSpacing
+				}
+			}
+			x := laneX[i] + (laneWidths[i]-cellWidth)/2
+			for _, n := range cell {
+				n.x = x
+				n.y = rowY + (rowHeights[r]-n.h)/2
+				x += n.w + nodeSpacing
+			}
+		}
+		rowY += rowHeights[r] + rankSpacing
+	}
+
+	dia.root.x, dia.root.y = marginX, top
+	dia.root.w, dia.root.h = totalWidth, rowY-rankSpacing/2-top
+	return totalWidth + 2*marginX, rowY + elemenetsPadding
+}
+
+func (dia *Diagram) renderActivity() {
+	font := dia.themedElementFont()
+	dia.useFont(font)
+	top, bottom := dia.root.y, dia.root.y+dia.root.h
+	for i, lane := range dia.elemenets {
+		coords := dia.elemenetsCoordMap[lane.Name]
+		laneWidth := dia.root.x + dia.root.w - coords.X
+		if i+1 < len(dia.elemenets) {
+			laneWidth = dia.elemenetsCoordMap[dia.elemenets[i+1].Name].X - coords.X
+		}
+		dia.drawBox(coords.X, top, laneWidth, dia.headerHeight, dia.theme.ParticipantFill, font.Color, lane.Name)
+		dia.drawBorder(dia.theme.Lifeline, lineStrokeWidth, coords.X, top, coords.X+laneWidth, bottom)
+	}
+
+	dia.renderLinks()
+
+	dia.useFont(font)
+	for _, n := range dia.root.children {
+		dia.setColor(dia.theme.Arrow)
+		centerX, centerY := n.x+n.w/2, n.y+n.h/2
+		switch n.Type {
+		case CIRCLE:
+			dia.dc.DrawCircle(centerX, centerY, circleRadius)
+			dia.dc.Fill()
+		case FINAL:
+			dia.dc.DrawCircle(centerX, centerY, circleRadius)
+			dia.setColor(dia.bgColor)
+			dia.dc.FillPreserve()
+			dia.setColor(dia.theme.Arrow)
+			dia.dc.SetLineWidth(rectangleStrokeWidth)
+			dia.dc.Stroke()
+			dia.dc.DrawCircle(centerX, centerY, circleRadius-5)
+			dia.dc.Fill()
+		case BAR:
+			dia.dc.DrawRectangle(n.x, n.y, n.w, n.h)
+			dia.dc.Fill()
+		case DECISION:
+			dia.drawDecisionNode(centerX, n.y, dia.theme.ParticipantFill, n.Label)
+		default:
+			dia.drawBox(n.x, n.y, n.w, n.h, dia.theme.ParticipantFill, font.Color, n.Label)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package zml
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProcessActivity(t *testing.T) {
+	in := `title: Order fulfilment
+type: activity
+start orphan
+lane Customer
+    start begin
+    action order: Place order
+    end done
+lane Shop
+    decision stock: In stock?
+    fork split
+    action ship: Ship parcel
+lane Customer
+    action pay: Pay
+begin -> order
+order -> stock
+stock -> ship: yes
+stock -> done: no
+ship -> done`
+	dia := NewDiagram("test")
+	dia.ProcessData([]byte(in))
+	if dia.kind != ACTIVITY {
+		t.Fatalf("kind = %s, want %s", dia.kind, ACTIVITY)
+	}
+
+	// lanes are kept in order of first appearance, a node before any lane
+	// is left out
+	var lanes []string
+	for _, e := range dia.elemenets {
+		lanes = append(lanes, e.Name)
+	}
+	if want := []string{"Customer", "Shop"}; !reflect.DeepEqual(lanes, want) {
+		t.Errorf("lanes = %q, want %q", lanes, want)
+	}
+
+	wantNodes := map[string]struct {
+		lane  string
+		kind  int
+		label string
+	}{
+		"begin": {"Customer", CIRCLE, " "},
+		"order": {"Customer", RECT, "Place order"},
+		"done":  {"Customer", FINAL, " "},
+		"stock": {"Shop", DECISION, "In stock?"},
+		"split": {"Shop", BAR, " "},
+		"ship":  {"Shop", RECT, "Ship parcel"},
+		"pay":   {"Customer", RECT, "Pay"},
+	}
+	if len(dia.nodes) != len(wantNodes) {
+		t.Errorf("got %d nodes, want %d", len(dia.nodes), len(wantNodes))
+	}
+	for id, want := range wantNodes {
+		n, ok := dia.nodes[id]
+		if !ok {
+			t.Errorf("node %s is missing", id)
+			continue
+		}
+		if n.Lane != want.lane || n.Type != want.kind || n.Label != want.label {
+			t.Errorf("node %s = {%s %d %q}, want {%s %d %q}", id, n.Lane, n.Type, n.Label, want.lane, want.kind, want.label)
+		}
+	}
+
+	wantLinks := []string{
+		"begin -> order: ",
+		"order -> stock: ",
+		"ship -> done: ",
+		"stock -> done: no",
+		"stock -> ship: yes",
+	}
+	if got := graphLinks(dia); !reflect.DeepEqual(got, wantLinks) {
+		t.Errorf("links = %q, want %q", got, wantLinks)
+	}
+}
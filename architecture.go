@@ -0,0 +1,122 @@
+package zml
+
+import (
+	"log"
+	"math"
+	"regexp"
+	"strings"
+)
+
+var archNodeTypes = map[string]int{
+	"system":    SYSTEM,
+	"container": CONTAINER,
+	"component": COMPONENT,
+	"boundary":  BOUNDARY,
+}
+
+var archNodeCaptions = map[int]string{
+	SYSTEM:    "[System]",
+	CONTAINER: "[Container]",
+	COMPONENT: "[Component]",
+}
+
+// processArchitecture parses the body of an architecture diagram:
+//
+//	boundary vpc: VPC {
+//	    container api: API
+//	}
+//	system bank: Bank
+//	api ->> bank: charges
+func (dia *Diagram) processArchitecture(lines []string) {
+	nodeRegexp := regexp.MustCompile(`^(system|container|component|boundary)\s+([\w.-]+)\s*(?::\s*([^{]*?))?\s*(\{)?$`)
+
+	var open []string
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//") {
+			continue
+		}
+		if line == "}" {
+			if len(open) == 0 {
+				log.Printf("unbalanced \"}\"")
+				continue
+			}
+			open = open[:len(open)-1]
+			continue
+		}
+		if parts := nodeRegexp.FindStringSubmatch(line); parts != nil {
+			parent := ""
+			for i := len(open) - 1; i >= 0 && parent == ""; i-- {
+				parent = open[i]
+			}
+			if err := dia.AddNode(parts[2], parts[3], archNodeTypes[parts[1]], parent); err != nil {
+				log.Printf(err.Error())
+				continue
+			}
+			if parts[4] == "{" {
+				// a brace after anything but a boundary is ignored, its "}"
+				// still has to match it
+				if parts[1] != "boundary" {
+					log.Printf("only boundaries can contain other nodes, ignoring \"{\": %s", line)
+					open = append(open, "")
+					continue
+				}
+				open = append(open, parts[2])
+			}
+			continue
+		}
+		if !dia.processLink(line) {
+			log.Printf("unrecognised line: %s", line)
+		}
+	}
+}
+
+// layoutArchitecture positions all nodes and returns the canvas size needed
+func (dia *Diagram) layoutArchitecture() (float64, float64) {
+	top := dia.top()
+	dia.layoutGroup(dia.root, true, func(n *node) {
+		dia.useFont(dia.themedElementFont())
+		labelWidth, labelHeight := dia.measureText(n.Label)
+		captionWidth, _ := dia.measureText(archNodeCaptions[n.Type])
+		n.w = math.Max(elemenetBoxWidth, math.Max(labelWidth, captionWidth)+2*elemenetsPadding/2)
+		n.h = math.Max(elemenetBoxHeight, 2*labelHeight+30)
+	})
+	marginX := math.Max(elemenetsPadding, (float64(dia.dc.Width())-dia.root.w)/2)
+	placeNode(dia.root, marginX, top)
+	return dia.root.w + 2*marginX, dia.root.h + top + elemenetsPadding
+}
+
+func (dia *Diagram) renderArchitecture() {
+	dia.renderArchNode(dia.root)
+
+	dia.renderLinks()
+}
+
+// renderArchNode draws boundaries before their members so members end up on top
+func (dia *Diagram) renderArchNode(n *node) {
+	font := dia.themedElementFont()
+	dia.useFont(font)
+	if n.isGroup() {
+		if n.parent != nil {
+			dia.drawGroup(n, groupShade(dia.theme.Fragment, n), true)
+		}
+		for _, c := range n.children {
+			dia.renderArchNode(c)
+		}
+		return
+	}
+
+	// systems are a shade darker and components a shade lighter than containers
+	fill := dia.theme.ParticipantFill
+	switch n.Type {
+	case SYSTEM:
+		fill = fill.Darken(10)
+	case COMPONENT:
+		fill = fill.Lighten(10)
+	}
+	dia.drawBox(n.x, n.y, n.w, n.h, fill, font.Color, "")
+	dia.setColor(dia.readableText(font.Color, fill))
+	centerX, centerY := n.x+n.w/2, n.y+n.h/2
+	dia.drawText(n.Label, centerX, centerY-4, 0.5, 0)
+	dia.drawText(archNodeCaptions[n.Type], centerX, centerY+4, 0.5, 1)
+}
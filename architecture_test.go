@@ -0,0 +1,85 @@
+package zml
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProcessArchitecture(t *testing.T) {
+	tests := []struct {
+		name  string
+		in    string
+		nodes map[string]graphNode
+		links []string
+	}{
+		{
+			name: "nested boundaries",
+			in: `type: architecture
+boundary vpc: VPC {
+    boundary k8s: Kubernetes cluster {
+        container api: Payments API
+        container worker
+    }
+    container db: Postgres
+}
+system psp: Payment provider
+api -> worker: enqueue
+worker -- db
+api ->> psp: charges`,
+			nodes: map[string]graphNode{
+				"vpc":    {"", BOUNDARY, "VPC"},
+				"k8s":    {"vpc", BOUNDARY, "Kubernetes cluster"},
+				"api":    {"k8s", CONTAINER, "Payments API"},
+				"worker": {"k8s", CONTAINER, "worker"},
+				"db":     {"vpc", CONTAINER, "Postgres"},
+				"psp":    {"", SYSTEM, "Payment provider"},
+			},
+			links: []string{"api -> psp: charges", "api -> worker: enqueue", "worker -- db: "},
+		},
+		{
+			// the "{" is ignored and its "}" doesn't close vpc
+			name: "brace after a container",
+			in: `type: architecture
+boundary vpc: VPC {
+    container api: API {
+        component handler: Handler
+    }
+    container db
+}
+system psp`,
+			nodes: map[string]graphNode{
+				"vpc":     {"", BOUNDARY, "VPC"},
+				"api":     {"vpc", CONTAINER, "API"},
+				"handler": {"vpc", COMPONENT, "Handler"},
+				"db":      {"vpc", CONTAINER, "db"},
+				"psp":     {"", SYSTEM, "psp"},
+			},
+		},
+		{
+			name: "unbalanced brace, comments and unknown nodes",
+			in: `type: architecture
+}
+# a comment
+// another
+container api
+api -> nowhere
+container api: twice`,
+			nodes: map[string]graphNode{
+				"api": {"", CONTAINER, "api"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		dia := NewDiagram("test")
+		dia.ProcessData([]byte(tt.in))
+		if dia.kind != ARCHITECTURE {
+			t.Fatalf("%s: kind = %s, want %s", tt.name, dia.kind, ARCHITECTURE)
+		}
+		if got := graphNodes(dia); !reflect.DeepEqual(got, tt.nodes) {
+			t.Errorf("%s: nodes = %v, want %v", tt.name, got, tt.nodes)
+		}
+		if got := graphLinks(dia); !reflect.DeepEqual(got, tt.links) {
+			t.Errorf("%s: links = %q, want %q", tt.name, got, tt.links)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package zml
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fogleman/gg"
+	"golang.org/x/image/font"
+)
+
+const (
+	// PNG renders diagrams to PNG images
+	PNG = "png"
+	// PDF renders diagrams to vector PDF documents
+	PDF = "pdf"
+	// TXT renders sequence diagrams as text, with box-drawing characters
+	TXT = "txt"
+	// JPEG renders diagrams to JPEG images, see SetQuality
+	JPEG = "jpg"
+	// GIF renders diagrams to GIF images of up to 256 colors
+	GIF = "gif"
+
+	// DefaultQuality is the JPEG quality used unless SetQuality says otherwise
+	DefaultQuality = 90
+
+	// baseDPI is the resolution of diagrams at scale 1, a CSS pixel
+	baseDPI = 96.0
+)
+
+// canvas is what diagrams draw on: a rasterCanvas for images, or a pdfCanvas
+// for vector output
+type canvas interface {
+	Width() int
+	Height() int
+	SetColor(c color.Color)
+	SetLineWidth(lineWidth float64)
+	SetDash(dashes ...float64)
+	SetFillRule(fillRule gg.FillRule)
+	MoveTo(x, y float64)
+	LineTo(x, y float64)
+	QuadraticTo(x1, y1, x2, y2 float64)
+	DrawLine(x1, y1, x2, y2 float64)
+	DrawRectangle(x, y, w, h float64)
+	DrawRoundedRectangle(x, y, w, h, r float64)
+	DrawCircle(x, y, r float64)
+	Stroke()
+	Fill()
+	FillPreserve()
+	SetFontFace(fontFace font.Face)
+	MeasureString(s string) (w, h float64)
+	DrawString(s string, x, y float64)
+	DrawStringAnchored(s string, x, y, ax, ay float64)
+}
+
+// linker is implemented by canvases that can make an area a hyperlink
+type linker interface {
+	link(x, y, w, h float64, url string)
+}
+
+// rasterCanvas is a gg.Context drawing `scale` image pixels to a pixel of
+// the diagram, so the diagram lays out the same at any resolution. Text is
+// set in faces loaded at the scaled size, see useFont.
+type rasterCanvas struct {
+	*gg.Context
+	width  float64
+	height float64
+	scale  float64
+}
+
+func newRasterCanvas(width, height, scale float64) *rasterCanvas {
+	dc := gg.NewContext(int(width*scale), int(height*scale))
+	dc.Scale(scale, scale)
+	return &rasterCanvas{Context: dc, width: width, height: height, scale: scale}
+}
+
+func (c *rasterCanvas) Width() int {
+	return int(c.width)
+}
+
+func (c *rasterCanvas) Height() int {
+	return int(c.height)
+}
+
+// SetLineWidth and SetDash take diagram pixels, gg strokes in image pixels
+func (c *rasterCanvas) SetLineWidth(lineWidth float64) {
+	c.Context.SetLineWidth(lineWidth * c.scale)
+}
+
+func (c *rasterCanvas) SetDash(dashes ...float64) {
+	scaled := make([]float64, len(dashes))
+	for i, dash := range dashes {
+		scaled[i] = dash * c.scale
+	}
+	c.Context.SetDash(scaled...)
+}
+
+func (c *rasterCanvas) MeasureString(s string) (float64, float64) {
+	w, h := c.Context.MeasureString(s)
+	return w / c.scale, h / c.scale
+}
+
+// DrawString sets text untransformed, in the scaled face, as gg would
+// otherwise stretch the glyphs and blur them
+func (c *rasterCanvas) DrawString(s string, x, y float64) {
+	x, y = c.Context.TransformPoint(x, y)
+	c.Push()
+	c.Identity()
+	c.Context.DrawString(s, x, y)
+	c.Pop()
+}
+
+func (c *rasterCanvas) DrawStringAnchored(s string, x, y, ax, ay float64) {
+	w, h := c.MeasureString(s)
+	c.DrawString(s, x-ax*w, y+ay*h)
+}
+
+// savePNG writes the image to `filename`, recording its resolution and
+// adding `chunks`
+func (c *rasterCanvas) savePNG(filename string, chunks ...pngChunk) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := writePNG(f, c.Image(), append([]pngChunk{physChunk(baseDPI * c.scale)}, chunks...)...); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// saveJPEG writes the image to `filename` as a JPEG of `quality`
+func (c *rasterCanvas) saveJPEG(filename string, quality int) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := jpeg.Encode(f, c.Image(), &jpeg.Options{Quality: quality}); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// saveGIF writes the image to `filename` as a GIF in the colors of the
+// Plan 9 palette, keeping one for transparency when `transparent` is set
+func (c *rasterCanvas) saveGIF(filename string, transparent bool) error {
+	colors := color.Palette(palette.Plan9)
+	if transparent {
+		// transparency takes the place of the darkest blue, which has close
+		// neighbours, rather than of black or white
+		colors = append(color.Palette{color.Transparent, palette.Plan9[0]}, palette.Plan9[2:]...)
+	}
+	img := c.Image()
+	paletted := image.NewPaletted(img.Bounds(), colors)
+	draw.Draw(paletted, paletted.Rect, img, img.Bounds().Min, draw.Src)
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := gif.Encode(f, paletted, nil); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// SetScale renders image output `scale` times larger, e.g. 2 for high-DPI
+// displays, keeping the layout: fonts, lines and boxes all grow with it
+func (dia *Diagram) SetScale(scale float64) error {
+	if scale <= 0 || math.IsNaN(scale) || math.IsInf(scale, 0) {
+		return fmt.Errorf("scale must be above 0, not %g", scale)
+	}
+	dia.scale = scale
+	return nil
+}
+
+// SetQuality sets the quality of JPEG output, from 1 to 100
+func (dia *Diagram) SetQuality(quality int) {
+	if quality < 1 || quality > 100 {
+		log.Printf("JPEG quality must be from 1 to 100, not %d", quality)
+		return
+	}
+	dia.quality = quality
+}
+
+// SetFormat sets the output format, PNG, PDF, TXT, JPEG ("jpeg" also works)
+// or GIF
+func (dia *Diagram) SetFormat(format string) error {
+	format = strings.ToLower(format)
+	switch format {
+	case PNG, PDF, TXT, JPEG, GIF:
+		dia.format = format
+	case "jpeg":
+		dia.format = JPEG
+	default:
+		return fmt.Errorf("unknown format \"%s\"", format)
+	}
+	if dia.debug {
+		log.Printf("format: %s", dia.format)
+	}
+	return nil
+}
+
+// CheckFormat returns an error when the diagram, once its data is processed,
+// can't be drawn in the output format: only sequence diagrams can be text
+func (dia *Diagram) CheckFormat() error {
+	if dia.format == TXT && dia.kind != SEQUENCE {
+		return fmt.Errorf("%s diagrams can't be rendered as text, only sequence diagrams", dia.kind)
+	}
+	return nil
+}
+
+// SetOutputFile writes the diagram to `filename` rather than next to its
+// input, in the format its extension names. The format is kept, and an error
+// returned, when the extension isn't one of a format.
+func (dia *Diagram) SetOutputFile(filename string) error {
+	dia.output = filename
+	if ext := filepath.Ext(filename); ext != "" {
+		if err := dia.SetFormat(ext[1:]); err != nil {
+			return fmt.Errorf("%s: %s", filename, err.Error())
+		}
+	}
+	return nil
+}
+
+// newCanvas returns a blank canvas of the output format
+func (dia *Diagram) newCanvas(width, height float64) canvas {
+	if dia.format == PDF {
+		return newPDFCanvas(width, height, plainText(parseRichText(lineBreakRegexp.ReplaceAllString(dia.title, " "))), dia.author)
+	}
+	return newRasterCanvas(width, height, dia.scale)
+}
+
+// save writes the canvas to `filename`, or draws it in the terminal when
+// previewing
+func (dia *Diagram) save(filename string) error {
+	switch dc := dia.dc.(type) {
+	case *pdfCanvas:
+		return dc.save(filename)
+	case *rasterCanvas:
+		if dia.preview != nil {
+			return writeTerminalImage(dia.preview, dia.previewGraphics, dc.Image())
+		}
+		switch dia.format {
+		case JPEG:
+			return dc.saveJPEG(filename, dia.quality)
+		case GIF:
+			return dc.saveGIF(filename, dia.transparent)
+		}
+		return dc.savePNG(filename, dia.sourceChunks()...)
+	}
+	return fmt.Errorf("can't save a %T", dia.dc)
+}
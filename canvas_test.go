@@ -0,0 +1,61 @@
+package zml
+
+import (
+	"image/color"
+	"image/gif"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveGIFTransparent(t *testing.T) {
+	c := newRasterCanvas(4, 2, 1)
+	for x, col := range []color.Color{color.White, color.Black, color.RGBA{0xff, 0, 0, 0xff}} {
+		c.DrawRectangle(float64(x), 0, 1, 1)
+		c.SetColor(col)
+		c.Fill()
+	}
+	filename := filepath.Join(t.TempDir(), "out.gif")
+	if err := c.saveGIF(filename, true); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := gif.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		x, y int
+		want color.NRGBA
+	}{
+		{0, 0, color.NRGBA{0xff, 0xff, 0xff, 0xff}},
+		{1, 0, color.NRGBA{0, 0, 0, 0xff}},
+		{2, 0, color.NRGBA{0xff, 0, 0, 0xff}},
+		{3, 0, color.NRGBA{}},
+		{0, 1, color.NRGBA{}},
+	} {
+		if got := color.NRGBAModel.Convert(img.At(tt.x, tt.y)).(color.NRGBA); got != tt.want {
+			t.Errorf("pixel (%d, %d) = %v, want %v", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestSetScale(t *testing.T) {
+	dia := NewDiagram("test")
+	for _, scale := range []float64{0, -1, math.NaN(), math.Inf(1)} {
+		if err := dia.SetScale(scale); err == nil {
+			t.Errorf("SetScale(%g) = nil, want an error", scale)
+		}
+	}
+	if dia.scale != 1 {
+		t.Errorf("a rejected scale changed it to %g", dia.scale)
+	}
+	if err := dia.SetScale(2.5); err != nil || dia.scale != 2.5 {
+		t.Errorf("SetScale(2.5) = %v, scale %g", err, dia.scale)
+	}
+}
@@ -2,10 +2,11 @@ package main
 
 import (
 	"fmt"
+	"io/fs"
 	"io/ioutil"
 	"log"
 	"os"
-	"strconv"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -18,7 +19,14 @@ var titleFont string
 var labelFont string
 var elementFont string
 var backgroundColor string
-var width, height float64
+var edgeStyle string
+var themeName string
+var minContrast float64
+var maxLabelWidth float64
+var format, output, author, pageSize string
+var quality int
+var dark, lightDark, autoColors, ascii, ansiColors, preview bool
+var width, height, scale float64
 var debug bool = false
 
 func populateAppMetadata(app *cli.App) {
@@ -41,14 +49,14 @@ COPYRIGHT:
    {{end}}
 `
 	app.Usage = "Diagram and flowchart tool"
-	app.Version = "0.21.3"
+	app.Version = zml.Version
 	app.EnableBashCompletion = true
 	cli.VersionFlag = cli.BoolFlag{
 		Name:  "print-version, V",
 		Usage: "print only the version",
 	}
 	app.Compiled = time.Now()
-	app.Description = "Converts ZML text to PNG diagrams.\n"
+	app.Description = "Converts ZML text to PNG, PDF, JPEG, GIF or text diagrams.\n"
 	app.Authors = []cli.Author{
 		{
 			Name:  "Jesse Portnoy",
@@ -59,22 +67,22 @@ COPYRIGHT:
 	app.Flags = []cli.Flag{
 		cli.StringFlag{
 			Name:        "font-dir, f",
-			Usage:       "Path to font dir.\n",
+			Usage:       "Path to font dir; font files and families are looked up there before the system font directories.\n",
 			Destination: &fontDir,
 		},
 		cli.StringFlag{
 			Name:        "title-font, t",
-			Usage:       `font to use for titles; e.g: Roboto-Bold.ttf,30`,
+			Usage:       `font to use for titles; a family, style and size, e.g: "Noto Sans:bold:30", or a file and size, e.g: Roboto-Bold.ttf,30`,
 			Destination: &titleFont,
 		},
 		cli.StringFlag{
 			Name:        "element-font, e",
-			Usage:       `font to use for node names; e.g: Roboto-Regular.ttf,15`,
+			Usage:       `font to use for node names; e.g: "Noto Sans:15" or Roboto-Regular.ttf,15`,
 			Destination: &elementFont,
 		},
 		cli.StringFlag{
 			Name:        "label-font, l",
-			Usage:       `font to use for connection labels; e.g: Roboto-Italic.ttf,15`,
+			Usage:       `font to use for connection labels; e.g: "Noto Sans:italic:15" or Roboto-Italic.ttf,15`,
 			Destination: &labelFont,
 		},
 		cli.Float64Flag{
@@ -89,11 +97,97 @@ COPYRIGHT:
 			Destination: &height,
 			Value:       1024,
 		},
+		cli.Float64Flag{
+			Name:        "scale",
+			Usage:       "Draw PNG output this many times larger, keeping the layout, e.g. 2 for high-DPI displays; the PNG records 96 DPI times the scale",
+			Destination: &scale,
+			Value:       1,
+		},
 		cli.StringFlag{
-			Name:        "background-color, b",
-			Usage:       `Background colour`,
+			Name:        "background-color, background, b",
+			Usage:       `Background colour; defaults to the theme's, "transparent" leaves PNG and GIF output see-through`,
 			Destination: &backgroundColor,
-			Value:       "white",
+		},
+		cli.StringFlag{
+			Name:        "format",
+			Usage:       "Output format: png, pdf, jpg, gif or txt (sequence diagrams only), written to <input-file>.<format>; defaults to the extension of --output, else png",
+			Destination: &format,
+			Value:       zml.PNG,
+		},
+		cli.StringFlag{
+			Name:        "output, o",
+			Usage:       "Output file, instead of <input-file>.<format>",
+			Destination: &output,
+		},
+		cli.IntFlag{
+			Name:        "quality",
+			Usage:       "JPEG quality, from 1 to 100",
+			Destination: &quality,
+			Value:       zml.DefaultQuality,
+		},
+		cli.BoolFlag{
+			Name:        "ascii",
+			Usage:       "Draw txt output with ASCII characters only, instead of box-drawing characters",
+			Destination: &ascii,
+		},
+		cli.BoolFlag{
+			Name:        "ansi-colors",
+			Usage:       "Color txt output with ANSI escape codes, for terminals",
+			Destination: &ansiColors,
+		},
+		cli.BoolFlag{
+			Name:        "preview",
+			Usage:       "Also draw the diagram in the terminal, with the Kitty or Sixel graphics protocol when the terminal has one (ZML_PREVIEW=kitty, sixel or text picks), as text otherwise",
+			Destination: &preview,
+		},
+		cli.StringFlag{
+			Name:        "author",
+			Usage:       "Author recorded in the PDF metadata",
+			Destination: &author,
+		},
+		cli.StringFlag{
+			Name:        "page-size",
+			Usage:       `Split sequence diagrams into pages of this size, e.g: A4, Letter:landscape or 800x600`,
+			Destination: &pageSize,
+		},
+		cli.StringFlag{
+			Name:        "theme",
+			Usage:       "Built-in theme (" + strings.Join(zml.ThemeNames(), ", ") + ") or path to a JSON/YAML theme file (.json, .yaml or .yml, or a path with a directory)",
+			Destination: &themeName,
+			Value:       "default",
+		},
+		cli.BoolFlag{
+			Name:        "dark",
+			Usage:       "Render a dark variant of the theme",
+			Destination: &dark,
+		},
+		cli.BoolFlag{
+			Name:        "light-dark",
+			Usage:       "Render both the theme and its dark variant, to <input-file>-light.png and <input-file>-dark.png",
+			Destination: &lightDark,
+		},
+		cli.BoolFlag{
+			Name:        "auto-colors",
+			Usage:       "Give each sequence diagram participant without a fill of its own a distinct color",
+			Destination: &autoColors,
+		},
+		cli.Float64Flag{
+			Name:        "min-contrast",
+			Usage:       "Lowest contrast ratio (1-21) between a label and its fill before it is redrawn in black or white; 0 disables the check",
+			Destination: &minContrast,
+			Value:       zml.DefaultMinContrast,
+		},
+		cli.Float64Flag{
+			Name:        "max-label-width",
+			Usage:       "Width labels wrap at, besides explicit \\n or <br> breaks; 0 only wraps labels that would overflow their box or message",
+			Destination: &maxLabelWidth,
+			Value:       zml.DefaultMaxLabelWidth,
+		},
+		cli.StringFlag{
+			Name:        "edges",
+			Usage:       `How to route connections of graph diagrams: orthogonal, spline or straight`,
+			Destination: &edgeStyle,
+			Value:       zml.ORTHOGONAL,
 		},
 		cli.BoolFlag{
 			Name:        "debug, d",
@@ -103,10 +197,141 @@ COPYRIGHT:
 	}
 }
 
+// checkImages compares the source hash recorded in each PNG diagram under
+// the paths given with the hash of its ZML file, and lists ZML files with no
+// PNG diagram
+func checkImages(c *cli.Context) error {
+	paths := []string(c.Args())
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	var sources []string
+	images := map[string][]string{}
+	seen := map[string]bool{}
+	add := func(source string, found ...string) {
+		if _, ok := images[source]; !ok {
+			sources = append(sources, source)
+			images[source] = nil
+		}
+		for _, image := range found {
+			if !seen[image] {
+				seen[image] = true
+				images[source] = append(images[source], image)
+			}
+		}
+	}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		switch {
+		case info.IsDir():
+			err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if d.IsDir() && p != path && strings.HasPrefix(d.Name(), ".") {
+					return filepath.SkipDir
+				}
+				if !d.IsDir() && strings.HasSuffix(p, ".zml") {
+					add(p, zml.RenderedImages(p)...)
+				}
+				return nil
+			})
+			if err != nil {
+				log.Fatal(err)
+			}
+		case strings.HasSuffix(path, ".png"):
+			// x.zml.png, x.zml-dark.png and x.zml-2.png are drawn from x.zml
+			idx := strings.LastIndex(path, ".zml")
+			if idx < 0 {
+				log.Fatalf("%s: can't tell which ZML file it is drawn from", path)
+			}
+			add(path[:idx+len(".zml")], path)
+		default:
+			add(path, zml.RenderedImages(path)...)
+		}
+	}
+
+	stale := 0
+	for _, source := range sources {
+		data, err := ioutil.ReadFile(source)
+		if err != nil {
+			log.Fatal(err)
+		}
+		hash := zml.SourceHash(data)
+		if len(images[source]) == 0 {
+			fmt.Printf("%s: missing, no PNG diagram drawn from it\n", source)
+			stale++
+		}
+		for _, image := range images[source] {
+			embedded, err := imageHash(image)
+			switch {
+			case err != nil:
+				fmt.Printf("%s: %s\n", image, err.Error())
+				stale++
+			case embedded != hash:
+				fmt.Printf("%s: stale, %s changed\n", image, source)
+				stale++
+			case debug:
+				log.Printf("%s: up to date", image)
+			}
+		}
+	}
+	if stale > 0 {
+		return cli.NewExitError(fmt.Sprintf("%d diagram image(s) missing or out of date, render them again", stale), 1)
+	}
+	return nil
+}
+
+// imageHash returns the source hash recorded in the PNG `filename`
+func imageHash(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return zml.EmbeddedHash(f)
+}
+
 func main() {
 	app := cli.NewApp()
 	populateAppMetadata(app)
 
+	app.Commands = []cli.Command{
+		{
+			Name:      "extract",
+			Usage:     "Print the ZML source stored in a PNG diagram, to edit it",
+			ArgsUsage: "image.png",
+			Action: func(c *cli.Context) error {
+				if c.NArg() < 1 {
+					cli.ShowCommandHelp(c, "extract")
+					os.Exit(1)
+				}
+				f, err := os.Open(c.Args().Get(0))
+				if err != nil {
+					log.Fatal(err)
+				}
+				defer f.Close()
+				source, version, err := zml.ExtractSource(f)
+				if err != nil {
+					log.Fatalf("%s: %s", c.Args().Get(0), err.Error())
+				}
+				if debug {
+					log.Printf("written by zml %s", version)
+				}
+				fmt.Print(source)
+				return nil
+			},
+		},
+		{
+			Name:      "check",
+			Usage:     "List PNG diagrams missing or drawn from an older version of their ZML source, failing if there are any; for pre-commit hooks",
+			ArgsUsage: "[paths: ZML files, PNG diagrams or directories to search, the current one by default]",
+			Action:    checkImages,
+		},
+	}
 	app.Action = func(c *cli.Context) error {
 		log.SetFlags(log.LstdFlags | log.Lshortfile)
 		fmt.Printf("%f, %f, %s, %s\n", width, height, backgroundColor, fontDir)
@@ -128,37 +353,90 @@ func main() {
 			dia.SetDebug(true)
 		}
 		dia.SetFontDir(fontDir)
-		fontSize := 30.00
-		if titleFont != "" {
-			titleFontAttribs := strings.Split(titleFont, ",")
-			if len(titleFontAttribs) > 1 {
-				fontSize, _ = strconv.ParseFloat(titleFontAttribs[1], 64)
+		if output != "" {
+			// --format settles the format of a file with any other extension
+			if err := dia.SetOutputFile(output); err != nil {
+				if !c.IsSet("format") {
+					log.Fatal(err)
+				}
+				log.Printf(err.Error())
 			}
-			if err == nil {
-				dia.SetTitleFont(zml.Font{Name: titleFontAttribs[0], Size: fontSize})
+		}
+		if output == "" || c.IsSet("format") {
+			if err := dia.SetFormat(format); err != nil {
+				log.Fatal(err)
 			}
 		}
-		fontSize = 15.00
-		if labelFont != "" {
-			labelFontAttribs := strings.Split(labelFont, ",")
-			if len(labelFontAttribs) > 1 {
-				fontSize, _ = strconv.ParseFloat(labelFontAttribs[1], 64)
+		dia.SetQuality(quality)
+		dia.SetAuthor(author)
+		dia.SetASCII(ascii)
+		dia.SetANSIColors(ansiColors)
+		dia.SetAutoColors(autoColors)
+		dia.SetEdgeStyle(edgeStyle)
+		dia.SetMinContrast(minContrast)
+		dia.SetMaxLabelWidth(maxLabelWidth)
+		if err := dia.SetScale(scale); err != nil {
+			log.Fatal(err)
+		}
+		if pageSize != "" {
+			pageWidth, pageHeight, err := zml.ParsePageSize(pageSize)
+			if err != nil {
+				log.Fatal(err)
 			}
-			if err == nil {
-				dia.SetLabelFont(zml.Font{Name: labelFontAttribs[0], Size: fontSize})
+			dia.SetPageSize(pageWidth, pageHeight)
+		}
+		if lightDark {
+			dia.SetColorScheme(zml.LIGHTDARK)
+		} else if dark {
+			dia.SetColorScheme(zml.DARK)
+		}
+		var theme zml.Theme
+		// a theme file is told from a built-in name by its extension or path
+		// so files in the working directory don't shadow the built-ins
+		switch strings.ToLower(filepath.Ext(themeName)) {
+		case ".json", ".yaml", ".yml":
+			theme, err = zml.LoadTheme(themeName)
+		default:
+			if strings.ContainsAny(themeName, "/"+string(os.PathSeparator)) {
+				theme, err = zml.LoadTheme(themeName)
+			} else {
+				theme, err = zml.BuiltinTheme(themeName)
 			}
 		}
-		if elementFont != "" {
-			elementFontAttribs := strings.Split(elementFont, ",")
-			if len(elementFontAttribs) > 1 {
-				fontSize, _ = strconv.ParseFloat(elementFontAttribs[1], 64)
+		if err != nil {
+			log.Fatal(err)
+		}
+		dia.SetTheme(theme)
+		if backgroundColor != "" {
+			if _, err := zml.ParseColor(backgroundColor); err != nil {
+				log.Fatal(err)
 			}
-			if err == nil {
-				dia.SetElementLabelFont(zml.Font{Name: elementFontAttribs[0], Size: fontSize})
+		}
+		for _, spec := range []struct {
+			value string
+			set   func(zml.Font)
+		}{
+			{titleFont, dia.SetTitleFont},
+			{labelFont, dia.SetLabelFont},
+			{elementFont, dia.SetElementLabelFont},
+		} {
+			if spec.value == "" {
+				continue
 			}
+			font, err := zml.ParseFont(spec.value)
+			if err != nil {
+				log.Fatal(err)
+			}
+			spec.set(font)
 		}
 		dia.ProcessData(fileBytes)
+		if err := dia.CheckFormat(); err != nil {
+			log.Fatal(err)
+		}
 		dia.Render(width, height, backgroundColor)
+		if preview {
+			dia.Preview(os.Stdout, width, height, backgroundColor)
+		}
 		return nil
 	}
 	err := app.Run(os.Args)
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jessp01/zml"
+	"github.com/urfave/cli"
+)
+
+// check runs the check command on `paths` and returns its exit code
+func check(t *testing.T, paths ...string) int {
+	t.Helper()
+	set := flag.NewFlagSet("check", flag.ContinueOnError)
+	if err := set.Parse(paths); err != nil {
+		t.Fatal(err)
+	}
+	err := checkImages(cli.NewContext(cli.NewApp(), set, nil))
+	if err == nil {
+		return 0
+	}
+	exit, ok := err.(cli.ExitCoder)
+	if !ok {
+		t.Fatalf("check %v: %v", paths, err)
+	}
+	return exit.ExitCode()
+}
+
+func TestCheckImages(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	render := func(path string) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dia := zml.NewDiagram(path)
+		dia.ProcessData(data)
+		dia.Render(400, 300, "")
+	}
+
+	drawn := write("drawn.zml", "A->>B: hi")
+	render(drawn)
+	if code := check(t, dir); code != 0 {
+		t.Errorf("check with every image up to date exited %d", code)
+	}
+
+	// a ZML file never rendered is reported, alone and in its directory
+	missing := write("missing.zml", "A->>B: hello")
+	if code := check(t, missing); code != 1 {
+		t.Errorf("check of %s, with no image, exited %d, want 1", missing, code)
+	}
+	if code := check(t, dir); code != 1 {
+		t.Errorf("check of a directory with an unrendered ZML file exited %d, want 1", code)
+	}
+	render(missing)
+	if code := check(t, dir); code != 0 {
+		t.Errorf("check after rendering it exited %d", code)
+	}
+
+	write("drawn.zml", "A->>B: bye")
+	if code := check(t, drawn+".png"); code != 1 {
+		t.Errorf("check of an image whose source changed exited %d, want 1", code)
+	}
+}
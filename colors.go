@@ -1,216 +1,311 @@
 package zml
 
 import (
+	"fmt"
+	"image/color"
 	"math"
 	"strconv"
 	"strings"
+	"unicode"
 )
 
-// Color is a RGB set of ints; for a nice picker
+// Color is a RGBA set of ints from 0 to 255; for a nice picker
 // see https://www.w3schools.com/colors/colors_picker.asp
+// The zero Color is fully transparent, themes and styles read it as unset.
 type Color struct {
-	Red, Green, Blue int
+	Red, Green, Blue, Alpha int
 }
 
-// colornames maps SVG color names to RGB triples.
+// RGBA implements image/color.Color, so a Color can be handed to gg directly
+func (c Color) RGBA() (r, g, b, a uint32) {
+	return color.NRGBA{R: uint8(c.Red), G: uint8(c.Green), B: uint8(c.Blue), A: uint8(c.Alpha)}.RGBA()
+}
+
+// String returns the color as "#rrggbb", or "#rrggbbaa" when not opaque
+func (c Color) String() string {
+	if c.Alpha == 255 {
+		return fmt.Sprintf("#%02x%02x%02x", c.Red, c.Green, c.Blue)
+	}
+	return fmt.Sprintf("#%02x%02x%02x%02x", c.Red, c.Green, c.Blue, c.Alpha)
+}
+
+// colornames maps CSS color names to RGBA values.
 var colornames = map[string]Color{
-	"aliceblue":            {240, 248, 255},
-	"antiquewhite":         {250, 235, 215},
-	"aqua":                 {0, 255, 255},
-	"aquamarine":           {127, 255, 212},
-	"azure":                {240, 255, 255},
-	"beige":                {245, 245, 220},
-	"bisque":               {255, 228, 196},
-	"black":                {0, 0, 0},
-	"charlestongreen":      {35, 43, 43},
-	"eerieblack":           {27, 27, 27},
-	"jetblack":             {52, 52, 52},
-	"blanchedalmond":       {255, 235, 205},
-	"blue":                 {0, 0, 255},
-	"blueviolet":           {138, 43, 226},
-	"brown":                {165, 42, 42},
-	"burlywood":            {222, 184, 135},
-	"cadetblue":            {95, 158, 160},
-	"chartreuse":           {127, 255, 0},
-	"chocolate":            {210, 105, 30},
-	"coral":                {255, 127, 80},
-	"cornflowerblue":       {100, 149, 237},
-	"cornsilk":             {255, 248, 220},
-	"crimson":              {220, 20, 60},
-	"cyan":                 {0, 255, 255},
-	"darkblue":             {0, 0, 139},
-	"darkcyan":             {0, 139, 139},
-	"darkgoldenrod":        {184, 134, 11},
-	"darkgray":             {169, 169, 169},
-	"darkgreen":            {0, 100, 0},
-	"darkgrey":             {169, 169, 169},
-	"darkkhaki":            {189, 183, 107},
-	"darkmagenta":          {139, 0, 139},
-	"darkolivegreen":       {85, 107, 47},
-	"darkorange":           {255, 140, 0},
-	"darkorchid":           {153, 50, 204},
-	"darkred":              {139, 0, 0},
-	"darksalmon":           {233, 150, 122},
-	"darkseagreen":         {143, 188, 143},
-	"darkslateblue":        {72, 61, 139},
-	"darkslategray":        {47, 79, 79},
-	"darkslategrey":        {47, 79, 79},
-	"darkturquoise":        {0, 206, 209},
-	"darkviolet":           {148, 0, 211},
-	"deeppink":             {255, 20, 147},
-	"deepskyblue":          {0, 191, 255},
-	"dimgray":              {105, 105, 105},
-	"dimgrey":              {105, 105, 105},
-	"dodgerblue":           {30, 144, 255},
-	"firebrick":            {178, 34, 34},
-	"floralwhite":          {255, 250, 240},
-	"forestgreen":          {34, 139, 34},
-	"fuchsia":              {255, 0, 255},
-	"gainsboro":            {220, 220, 220},
-	"ghostwhite":           {248, 248, 255},
-	"gold":                 {255, 215, 0},
-	"goldenrod":            {218, 165, 32},
-	"gray":                 {128, 128, 128},
-	"green":                {0, 128, 0},
-	"greenyellow":          {173, 255, 47},
-	"grey":                 {128, 128, 128},
-	"honeydew":             {240, 255, 240},
-	"hotpink":              {255, 105, 180},
-	"indianred":            {205, 92, 92},
-	"indigo":               {75, 0, 130},
-	"ivory":                {255, 255, 240},
-	"khaki":                {240, 230, 140},
-	"lavender":             {230, 230, 250},
-	"lavenderblush":        {255, 240, 245},
-	"lawngreen":            {124, 252, 0},
-	"lemonchiffon":         {255, 250, 205},
-	"lightblue":            {173, 216, 230},
-	"lightcoral":           {240, 128, 128},
-	"lightcyan":            {224, 255, 255},
-	"lightgoldenrodyellow": {250, 250, 210},
-	"lightgray":            {211, 211, 211},
-	"lightgreen":           {144, 238, 144},
-	"lightgrey":            {211, 211, 211},
-	"lightpink":            {255, 182, 193},
-	"lightsalmon":          {255, 160, 122},
-	"lightseagreen":        {32, 178, 170},
-	"lightskyblue":         {135, 206, 250},
-	"lightslategray":       {119, 136, 153},
-	"lightslategrey":       {119, 136, 153},
-	"lightsteelblue":       {176, 196, 222},
-	"lightyellow":          {255, 255, 224},
-	"lime":                 {0, 255, 0},
-	"limegreen":            {50, 205, 50},
-	"linen":                {250, 240, 230},
-	"magenta":              {255, 0, 255},
-	"maroon":               {128, 0, 0},
-	"mediumaquamarine":     {102, 205, 170},
-	"mediumblue":           {0, 0, 205},
-	"mediumorchid":         {186, 85, 211},
-	"mediumpurple":         {147, 112, 219},
-	"mediumseagreen":       {60, 179, 113},
-	"mediumslateblue":      {123, 104, 238},
-	"mediumspringgreen":    {0, 250, 154},
-	"mediumturquoise":      {72, 209, 204},
-	"mediumvioletred":      {199, 21, 133},
-	"midnightblue":         {25, 25, 112},
-	"mintcream":            {245, 255, 250},
-	"mistyrose":            {255, 228, 225},
-	"moccasin":             {255, 228, 181},
-	"navajowhite":          {255, 222, 173},
-	"navy":                 {0, 0, 128},
-	"oldlace":              {253, 245, 230},
-	"olive":                {128, 128, 0},
-	"olivedrab":            {107, 142, 35},
-	"orange":               {255, 165, 0},
-	"orangered":            {255, 69, 0},
-	"orchid":               {218, 112, 214},
-	"palegoldenrod":        {238, 232, 170},
-	"palegreen":            {152, 251, 152},
-	"paleturquoise":        {175, 238, 238},
-	"palevioletred":        {219, 112, 147},
-	"papayawhip":           {255, 239, 213},
-	"peachpuff":            {255, 218, 185},
-	"peru":                 {205, 133, 63},
-	"pink":                 {255, 192, 203},
-	"plum":                 {221, 160, 221},
-	"powderblue":           {176, 224, 230},
-	"purple":               {128, 0, 128},
-	"red":                  {255, 0, 0},
-	"platered":             {255, 80, 80},
-	"rosybrown":            {188, 143, 143},
-	"royalblue":            {65, 105, 225},
-	"saddlebrown":          {139, 69, 19},
-	"salmon":               {250, 128, 114},
-	"sandybrown":           {244, 164, 96},
-	"seagreen":             {46, 139, 87},
-	"seashell":             {255, 245, 238},
-	"sienna":               {160, 82, 45},
-	"silver":               {192, 192, 192},
-	"skyblue":              {135, 206, 235},
-	"slateblue":            {106, 90, 205},
-	"slategray":            {112, 128, 144},
-	"slategrey":            {112, 128, 144},
-	"snow":                 {255, 250, 250},
-	"springgreen":          {0, 255, 127},
-	"steelblue":            {70, 130, 180},
-	"tan":                  {210, 180, 140},
-	"teal":                 {0, 128, 128},
-	"thistle":              {216, 191, 216},
-	"tomato":               {255, 99, 71},
-	"turquoise":            {64, 224, 208},
-	"violet":               {238, 130, 238},
-	"wheat":                {245, 222, 179},
-	"white":                {255, 255, 255},
-	"whitesmoke":           {245, 245, 245},
-	"yellow":               {255, 255, 0},
-	"yellowgreen":          {154, 205, 50},
+	"aliceblue":            {240, 248, 255, 255},
+	"antiquewhite":         {250, 235, 215, 255},
+	"aqua":                 {0, 255, 255, 255},
+	"aquamarine":           {127, 255, 212, 255},
+	"azure":                {240, 255, 255, 255},
+	"beige":                {245, 245, 220, 255},
+	"bisque":               {255, 228, 196, 255},
+	"black":                {0, 0, 0, 255},
+	"charlestongreen":      {35, 43, 43, 255},
+	"eerieblack":           {27, 27, 27, 255},
+	"jetblack":             {52, 52, 52, 255},
+	"blanchedalmond":       {255, 235, 205, 255},
+	"blue":                 {0, 0, 255, 255},
+	"blueviolet":           {138, 43, 226, 255},
+	"brown":                {165, 42, 42, 255},
+	"burlywood":            {222, 184, 135, 255},
+	"cadetblue":            {95, 158, 160, 255},
+	"chartreuse":           {127, 255, 0, 255},
+	"chocolate":            {210, 105, 30, 255},
+	"coral":                {255, 127, 80, 255},
+	"cornflowerblue":       {100, 149, 237, 255},
+	"cornsilk":             {255, 248, 220, 255},
+	"crimson":              {220, 20, 60, 255},
+	"cyan":                 {0, 255, 255, 255},
+	"darkblue":             {0, 0, 139, 255},
+	"darkcyan":             {0, 139, 139, 255},
+	"darkgoldenrod":        {184, 134, 11, 255},
+	"darkgray":             {169, 169, 169, 255},
+	"darkgreen":            {0, 100, 0, 255},
+	"darkgrey":             {169, 169, 169, 255},
+	"darkkhaki":            {189, 183, 107, 255},
+	"darkmagenta":          {139, 0, 139, 255},
+	"darkolivegreen":       {85, 107, 47, 255},
+	"darkorange":           {255, 140, 0, 255},
+	"darkorchid":           {153, 50, 204, 255},
+	"darkred":              {139, 0, 0, 255},
+	"darksalmon":           {233, 150, 122, 255},
+	"darkseagreen":         {143, 188, 143, 255},
+	"darkslateblue":        {72, 61, 139, 255},
+	"darkslategray":        {47, 79, 79, 255},
+	"darkslategrey":        {47, 79, 79, 255},
+	"darkturquoise":        {0, 206, 209, 255},
+	"darkviolet":           {148, 0, 211, 255},
+	"deeppink":             {255, 20, 147, 255},
+	"deepskyblue":          {0, 191, 255, 255},
+	"dimgray":              {105, 105, 105, 255},
+	"dimgrey":              {105, 105, 105, 255},
+	"dodgerblue":           {30, 144, 255, 255},
+	"firebrick":            {178, 34, 34, 255},
+	"floralwhite":          {255, 250, 240, 255},
+	"forestgreen":          {34, 139, 34, 255},
+	"fuchsia":              {255, 0, 255, 255},
+	"gainsboro":            {220, 220, 220, 255},
+	"ghostwhite":           {248, 248, 255, 255},
+	"gold":                 {255, 215, 0, 255},
+	"goldenrod":            {218, 165, 32, 255},
+	"gray":                 {128, 128, 128, 255},
+	"green":                {0, 128, 0, 255},
+	"greenyellow":          {173, 255, 47, 255},
+	"grey":                 {128, 128, 128, 255},
+	"honeydew":             {240, 255, 240, 255},
+	"hotpink":              {255, 105, 180, 255},
+	"indianred":            {205, 92, 92, 255},
+	"indigo":               {75, 0, 130, 255},
+	"ivory":                {255, 255, 240, 255},
+	"khaki":                {240, 230, 140, 255},
+	"lavender":             {230, 230, 250, 255},
+	"lavenderblush":        {255, 240, 245, 255},
+	"lawngreen":            {124, 252, 0, 255},
+	"lemonchiffon":         {255, 250, 205, 255},
+	"lightblue":            {173, 216, 230, 255},
+	"lightcoral":           {240, 128, 128, 255},
+	"lightcyan":            {224, 255, 255, 255},
+	"lightgoldenrodyellow": {250, 250, 210, 255},
+	"lightgray":            {211, 211, 211, 255},
+	"lightgreen":           {144, 238, 144, 255},
+	"lightgrey":            {211, 211, 211, 255},
+	"lightpink":            {255, 182, 193, 255},
+	"lightsalmon":          {255, 160, 122, 255},
+	"lightseagreen":        {32, 178, 170, 255},
+	"lightskyblue":         {135, 206, 250, 255},
+	"lightslategray":       {119, 136, 153, 255},
+	"lightslategrey":       {119, 136, 153, 255},
+	"lightsteelblue":       {176, 196, 222, 255},
+	"lightyellow":          {255, 255, 224, 255},
+	"lime":                 {0, 255, 0, 255},
+	"limegreen":            {50, 205, 50, 255},
+	"linen":                {250, 240, 230, 255},
+	"magenta":              {255, 0, 255, 255},
+	"maroon":               {128, 0, 0, 255},
+	"mediumaquamarine":     {102, 205, 170, 255},
+	"mediumblue":           {0, 0, 205, 255},
+	"mediumorchid":         {186, 85, 211, 255},
+	"mediumpurple":         {147, 112, 219, 255},
+	"mediumseagreen":       {60, 179, 113, 255},
+	"mediumslateblue":      {123, 104, 238, 255},
+	"mediumspringgreen":    {0, 250, 154, 255},
+	"mediumturquoise":      {72, 209, 204, 255},
+	"mediumvioletred":      {199, 21, 133, 255},
+	"midnightblue":         {25, 25, 112, 255},
+	"mintcream":            {245, 255, 250, 255},
+	"mistyrose":            {255, 228, 225, 255},
+	"moccasin":             {255, 228, 181, 255},
+	"navajowhite":          {255, 222, 173, 255},
+	"navy":                 {0, 0, 128, 255},
+	"oldlace":              {253, 245, 230, 255},
+	"olive":                {128, 128, 0, 255},
+	"olivedrab":            {107, 142, 35, 255},
+	"orange":               {255, 165, 0, 255},
+	"orangered":            {255, 69, 0, 255},
+	"orchid":               {218, 112, 214, 255},
+	"palegoldenrod":        {238, 232, 170, 255},
+	"palegreen":            {152, 251, 152, 255},
+	"paleturquoise":        {175, 238, 238, 255},
+	"palevioletred":        {219, 112, 147, 255},
+	"papayawhip":           {255, 239, 213, 255},
+	"peachpuff":            {255, 218, 185, 255},
+	"peru":                 {205, 133, 63, 255},
+	"pink":                 {255, 192, 203, 255},
+	"plum":                 {221, 160, 221, 255},
+	"powderblue":           {176, 224, 230, 255},
+	"purple":               {128, 0, 128, 255},
+	"rebeccapurple":        {102, 51, 153, 255},
+	"red":                  {255, 0, 0, 255},
+	"platered":             {255, 80, 80, 255},
+	"rosybrown":            {188, 143, 143, 255},
+	"royalblue":            {65, 105, 225, 255},
+	"saddlebrown":          {139, 69, 19, 255},
+	"salmon":               {250, 128, 114, 255},
+	"sandybrown":           {244, 164, 96, 255},
+	"seagreen":             {46, 139, 87, 255},
+	"seashell":             {255, 245, 238, 255},
+	"sienna":               {160, 82, 45, 255},
+	"silver":               {192, 192, 192, 255},
+	"skyblue":              {135, 206, 235, 255},
+	"slateblue":            {106, 90, 205, 255},
+	"slategray":            {112, 128, 144, 255},
+	"slategrey":            {112, 128, 144, 255},
+	"snow":                 {255, 250, 250, 255},
+	"springgreen":          {0, 255, 127, 255},
+	"steelblue":            {70, 130, 180, 255},
+	"tan":                  {210, 180, 140, 255},
+	"teal":                 {0, 128, 128, 255},
+	"thistle":              {216, 191, 216, 255},
+	"tomato":               {255, 99, 71, 255},
+	"turquoise":            {64, 224, 208, 255},
+	"violet":               {238, 130, 238, 255},
+	"wheat":                {245, 222, 179, 255},
+	"white":                {255, 255, 255, 255},
+	"whitesmoke":           {245, 245, 245, 255},
+	"yellow":               {255, 255, 0, 255},
+	"yellowgreen":          {154, 205, 50, 255},
 }
 
-// Colorlookup returns a RGB triple corresponding to the named color, "rgb(r,g,b)" or "#rrggbb" string.
+// Colorlookup returns a RGB triple corresponding to any color ParseColor understands.
 // On error, return black.
 func Colorlookup(s string) (r int, g int, b int) {
-	color, ok := colornames[s]
-	if ok {
-		return color.Red, color.Green, color.Blue
+	c, err := ParseColor(s)
+	if err != nil {
+		return 0, 0, 0
+	}
+	return c.Red, c.Green, c.Blue
+}
+
+// ParseColor reads a CSS color name (case insensitive) or one of the
+// notations "#rgb", "#rgba", "#rrggbb", "#rrggbbaa", "rgb(r, g, b)",
+// "rgba(r, g, b, a)", "hsl(h, s%, l%)", "hsla(h, s%, l%, a)" and
+// "hsv(h, s, v)". Function arguments may also be space separated with the
+// alpha after a slash, as in "rgb(255 0 0 / 50%)".
+func ParseColor(s string) (Color, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if c, ok := colornames[s]; ok {
+		return c, nil
 	}
-	var red, green, blue int
-	ls := len(s)
-	// rgb(r, g, b)
-	if strings.HasPrefix(s, "rgb(") && strings.HasSuffix(s, ")") && ls > 5 {
-		v := colorNumbers(s)
-		if len(v) == 3 {
-			red, _ = strconv.Atoi(v[0])
-			green, _ = strconv.Atoi(v[1])
-			blue, _ = strconv.Atoi(v[2])
+	if s == "transparent" {
+		return Color{}, nil
+	}
+	if strings.HasPrefix(s, "#") {
+		return parseHexColor(s)
+	}
+
+	open := strings.IndexByte(s, '(')
+	if open < 0 || !strings.HasSuffix(s, ")") {
+		return Color{}, fmt.Errorf("unknown color \"%s\"", s)
+	}
+	name, args := s[:open], colorArgs(s[open+1:len(s)-1])
+	if len(args) != 3 && len(args) != 4 {
+		return Color{}, fmt.Errorf("%s: expected 3 or 4 values, got %d", s, len(args))
+	}
+	var values [4]float64
+	var err error
+	switch name {
+	case "rgb", "rgba":
+		for i := 0; i < 3 && err == nil; i++ {
+			values[i], err = colorValue(args[i], 255)
 		}
-		return red, green, blue
+	case "hsl", "hsla", "hsv":
+		values[0], err = strconv.ParseFloat(strings.TrimSuffix(args[0], "deg"), 64)
+		values[0] = math.Mod(math.Mod(values[0], 360)+360, 360)
+		for i := 1; i < 3 && err == nil; i++ {
+			values[i], err = colorValue(args[i], 100)
+		}
+	default:
+		return Color{}, fmt.Errorf("unknown color function \"%s\"", name)
 	}
-	// #rrggbb
-	if strings.HasPrefix(s, "#") && ls == 7 {
-		r, _ := strconv.ParseInt(s[1:3], 16, 32)
-		g, _ := strconv.ParseInt(s[3:5], 16, 32)
-		b, _ := strconv.ParseInt(s[5:7], 16, 32)
-		return int(r), int(g), int(b)
+	values[3] = 255
+	if len(args) == 4 && err == nil {
+		values[3], err = colorValue(args[3], 1)
+		values[3] *= 255
 	}
-	// hsv(hue, saturation, value)
-	if strings.HasPrefix(s, "hsv(") && strings.HasSuffix(s, ")") && ls > 5 {
-		v := colorNumbers(s)
-		if len(v) == 3 {
-			hue, _ := strconv.ParseFloat(v[0], 64)
-			sat, _ := strconv.ParseFloat(v[1], 64)
-			value, _ := strconv.ParseFloat(v[2], 64)
-			red, green, blue = hsv2rgb(hue, sat, value)
+	if err != nil {
+		return Color{}, fmt.Errorf("%s: %w", s, err)
+	}
+
+	c := Color{Alpha: int(math.Round(values[3]))}
+	switch name {
+	case "rgb", "rgba":
+		c.Red, c.Green, c.Blue = int(math.Round(values[0])), int(math.Round(values[1])), int(math.Round(values[2]))
+	case "hsl", "hsla":
+		c.Red, c.Green, c.Blue = hsl2rgb(values[0], values[1], values[2])
+	case "hsv":
+		c.Red, c.Green, c.Blue = hsv2rgb(values[0], values[1], values[2])
+	}
+	return c, nil
+}
+
+// parseHexColor reads "#rgb", "#rgba", "#rrggbb" and "#rrggbbaa"
+func parseHexColor(s string) (Color, error) {
+	hex := s[1:]
+	if len(hex) == 3 || len(hex) == 4 {
+		// each digit stands for a doubled pair: #f80 is #ff8800
+		var long strings.Builder
+		for _, r := range hex {
+			long.WriteRune(r)
+			long.WriteRune(r)
 		}
-		return red, green, blue
+		hex = long.String()
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	if len(hex) != 8 {
+		return Color{}, fmt.Errorf("%s: expected 3, 4, 6 or 8 hex digits", s)
 	}
-	return 0, 0, 0
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return Color{}, fmt.Errorf("%s: invalid hex digits", s)
+	}
+	return Color{int(v >> 24), int(v >> 16 & 0xff), int(v >> 8 & 0xff), int(v & 0xff)}, nil
 }
 
-// colorNumbers returns a list of numbers from a comma separated list,
-// in the form of xxx(n1, n2, n3), after removing tabs and spaces.
-func colorNumbers(s string) []string {
-	return strings.Split(strings.NewReplacer(" ", "", "\t", "").Replace(s[4:len(s)-1]), ",")
+// colorArgs splits the arguments of a color function on commas, spaces and
+// the slash before the alpha value
+func colorArgs(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == '/' || unicode.IsSpace(r)
+	})
+}
+
+// colorValue reads a number between 0 and `max`, or a percentage of `max`
+func colorValue(s string, max float64) (float64, error) {
+	percent := strings.HasSuffix(s, "%")
+	s = strings.TrimSuffix(s, "%")
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number \"%s\"", s)
+	}
+	if percent {
+		// multiplying first keeps 50% of 255 at 127.5, which rounds up
+		v = v * max / 100
+	}
+	if v < 0 || v > max {
+		return 0, fmt.Errorf("%s is out of range 0-%g", s, max)
+	}
+	return v, nil
 }
 
 // hsv2rgb converts hsv(h (0-360), s (0-100), v (0-100)) to rgb
@@ -259,5 +354,139 @@ func hsv2rgb(h, s, v float64) (int, int, int) {
 	r += m
 	g += m
 	b += m
-	return int(r * 255), int(g * 255), int(b * 255)
+	return int(math.Round(r * 255)), int(math.Round(g * 255)), int(math.Round(b * 255))
+}
+
+// hsl2rgb converts hsl(h (0-360), s (0-100), l (0-100)) to rgb by way of hsv
+func hsl2rgb(h, s, l float64) (int, int, int) {
+	s /= 100
+	l /= 100
+	v := l + s*math.Min(l, 1-l)
+	sv := 0.0
+	if v > 0 {
+		sv = 2 * (1 - l/v)
+	}
+	return hsv2rgb(h, sv*100, v*100)
+}
+
+// ColorFromHSV returns the opaque color for hue `h` (0-360), saturation `s`
+// and value `v` (0-100)
+func ColorFromHSV(h, s, v float64) Color {
+	r, g, b := hsv2rgb(math.Mod(math.Mod(h, 360)+360, 360), clamp(s, 0, 100), clamp(v, 0, 100))
+	return Color{r, g, b, 255}
+}
+
+// ColorFromHSL returns the opaque color for hue `h` (0-360), saturation `s`
+// and lightness `l` (0-100)
+func ColorFromHSL(h, s, l float64) Color {
+	r, g, b := hsl2rgb(math.Mod(math.Mod(h, 360)+360, 360), clamp(s, 0, 100), clamp(l, 0, 100))
+	return Color{r, g, b, 255}
+}
+
+// HSV returns the hue (0-360), saturation and value (0-100) of `c`
+func (c Color) HSV() (h, s, v float64) {
+	r, g, b := float64(c.Red)/255, float64(c.Green)/255, float64(c.Blue)/255
+	max := math.Max(r, math.Max(g, b))
+	chroma := max - math.Min(r, math.Min(g, b))
+	switch {
+	case chroma == 0:
+		h = 0
+	case max == r:
+		h = 60 * math.Mod((g-b)/chroma+6, 6)
+	case max == g:
+		h = 60 * ((b-r)/chroma + 2)
+	default:
+		h = 60 * ((r-g)/chroma + 4)
+	}
+	if max > 0 {
+		s = chroma / max * 100
+	}
+	return h, s, max * 100
+}
+
+// HSL returns the hue (0-360), saturation and lightness (0-100) of `c`
+func (c Color) HSL() (h, s, l float64) {
+	h, sv, v := c.HSV()
+	sv, v = sv/100, v/100
+	l = v * (1 - sv/2)
+	if l > 0 && l < 1 {
+		s = (v - l) / math.Min(l, 1-l)
+	}
+	return h, s * 100, l * 100
+}
+
+// withHSL returns `c` with its lightness and saturation moved by `dl` and
+// `ds` points, keeping its alpha
+func (c Color) withHSL(ds, dl float64) Color {
+	h, s, l := c.HSL()
+	shifted := ColorFromHSL(h, s+ds, l+dl)
+	shifted.Alpha = c.Alpha
+	return shifted
+}
+
+// Lighten returns `c` with its lightness raised by `amount` points (0-100)
+func (c Color) Lighten(amount float64) Color {
+	return c.withHSL(0, amount)
+}
+
+// Darken returns `c` with its lightness lowered by `amount` points (0-100)
+func (c Color) Darken(amount float64) Color {
+	return c.withHSL(0, -amount)
+}
+
+// Saturate returns `c` with its saturation raised by `amount` points (0-100);
+// a negative amount desaturates
+func (c Color) Saturate(amount float64) Color {
+	return c.withHSL(amount, 0)
+}
+
+// Mix blends `c` with `other`; `weight` is the share of `other`, from 0 to 1
+func (c Color) Mix(other Color, weight float64) Color {
+	weight = clamp(weight, 0, 1)
+	blend := func(a, b int) int {
+		return int(math.Round(float64(a)*(1-weight) + float64(b)*weight))
+	}
+	return Color{blend(c.Red, other.Red), blend(c.Green, other.Green), blend(c.Blue, other.Blue), blend(c.Alpha, other.Alpha)}
+}
+
+// Luminance returns the WCAG relative luminance of `c`, from 0 for black to
+// 1 for white
+func (c Color) Luminance() float64 {
+	linear := func(channel int) float64 {
+		v := float64(channel) / 255
+		if v <= 0.03928 {
+			return v / 12.92
+		}
+		return math.Pow((v+0.055)/1.055, 2.4)
+	}
+	return 0.2126*linear(c.Red) + 0.7152*linear(c.Green) + 0.0722*linear(c.Blue)
+}
+
+// ContrastRatio returns the WCAG contrast ratio between `c` and `other`,
+// from 1 for identical colors to 21 for black on white
+func (c Color) ContrastRatio(other Color) float64 {
+	l1, l2 := c.Luminance(), other.Luminance()
+	if l1 < l2 {
+		l1, l2 = l2, l1
+	}
+	return (l1 + 0.05) / (l2 + 0.05)
+}
+
+// Palette returns `n` visually distinct colors, e.g. to give each participant
+// its own fill. Hues advance by the golden angle so neighbours never look
+// alike however many colors are asked for, and the lightness alternates.
+func Palette(n int) []Color {
+	colors := make([]Color, n)
+	for i := range colors {
+		lightness := 45.0
+		if i%2 == 1 {
+			lightness = 60
+		}
+		colors[i] = ColorFromHSL(210+float64(i)*137.508, 65, lightness)
+	}
+	return colors
+}
+
+func clamp(v, low, high float64) float64 {
+	return math.Max(low, math.Min(high, v))
 }
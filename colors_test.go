@@ -0,0 +1,196 @@
+package zml
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Color
+	}{
+		{"red", Color{255, 0, 0, 255}},
+		{"  AliceBlue ", Color{240, 248, 255, 255}},
+		{"transparent", Color{}},
+		{"#f80", Color{255, 136, 0, 255}},
+		{"#f808", Color{255, 136, 0, 136}},
+		{"#ff8800", Color{255, 136, 0, 255}},
+		{"#FF880080", Color{255, 136, 0, 128}},
+		{"rgb(255, 0, 0)", Color{255, 0, 0, 255}},
+		{"rgb(100%, 50%, 0%)", Color{255, 128, 0, 255}},
+		{"rgba(0,0,255,0.5)", Color{0, 0, 255, 128}},
+		{"rgb(255 0 0 / 50%)", Color{255, 0, 0, 128}},
+		{"hsl(120, 100%, 50%)", Color{0, 255, 0, 255}},
+		{"hsl(480deg 100% 50%)", Color{0, 255, 0, 255}},
+		{"hsla(0,100%,50%,.25)", Color{255, 0, 0, 64}},
+		{"hsv(240,100,100)", Color{0, 0, 255, 255}},
+	}
+	for _, tt := range tests {
+		got, err := ParseColor(tt.in)
+		if err != nil {
+			t.Errorf("ParseColor(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseColor(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseColorErrors(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"notacolor",
+		"#12",
+		"#12345",
+		"#ggg",
+		"rgb(1, 2)",
+		"rgb(1, 2, 3, 4, 5)",
+		"rgb(300, 0, 0)",
+		"rgb(-1, 0, 0)",
+		"rgba(0, 0, 0, 2)",
+		"rgb(a, b, c)",
+		"hsl(0, 120%, 50%)",
+		"cmyk(0, 0, 0, 0)",
+		"rgb(0, 0, 0",
+	} {
+		if c, err := ParseColor(in); err == nil {
+			t.Errorf("ParseColor(%q) = %v, want an error", in, c)
+		}
+	}
+}
+
+func TestColorUnmarshalText(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Color
+		wantErr bool
+	}{
+		{`{"c": "#ff5050"}`, Color{255, 80, 80, 255}, false},
+		{`{"c": "notacolor"}`, Color{}, true},
+		{`{"c": "LightBlue"}`, Color{173, 216, 230, 255}, false},
+		{`{"c": "rgb(0 0 0 / 0.5)"}`, Color{0, 0, 0, 128}, false},
+		{`{"c": "#12"}`, Color{}, true},
+	}
+	for _, tt := range tests {
+		var v struct {
+			C Color `json:"c"`
+		}
+		err := json.Unmarshal([]byte(tt.in), &v)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Unmarshal(%s): error %v, want error %t", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && v.C != tt.want {
+			t.Errorf("Unmarshal(%s) = %v, want %v", tt.in, v.C, tt.want)
+		}
+	}
+}
+
+func TestPalette(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 5, 12} {
+		colors := Palette(n)
+		if len(colors) != n {
+			t.Fatalf("Palette(%d) returned %d colors", n, len(colors))
+		}
+		seen := map[Color]bool{}
+		for i, c := range colors {
+			if c.Alpha != 255 {
+				t.Errorf("Palette(%d)[%d] = %v isn't opaque", n, i, c)
+			}
+			if seen[c] {
+				t.Errorf("Palette(%d)[%d] = %v repeats", n, i, c)
+			}
+			seen[c] = true
+			// neighbours are far apart on the color wheel
+			if i > 0 {
+				h0, _, _ := colors[i-1].HSL()
+				h1, _, _ := c.HSL()
+				if d := math.Abs(h1 - h0); math.Min(d, 360-d) < 90 {
+					t.Errorf("Palette(%d)[%d] and [%d] are %.0f° apart", n, i-1, i, math.Min(d, 360-d))
+				}
+			}
+		}
+	}
+	// the first colors don't change when more are asked for
+	if a, b := Palette(3), Palette(8); !reflect.DeepEqual(a, b[:3]) {
+		t.Errorf("Palette(3) = %v, Palette(8) starts with %v", a, b[:3])
+	}
+}
+
+func TestAutoColors(t *testing.T) {
+	dia := NewDiagram("test")
+	dia.ProcessData([]byte("participant B {fill: red}\nA->>B: hi\nB->>C: hi"))
+	if got := dia.themedParticipantFill(0); got != dia.theme.ParticipantFill {
+		t.Errorf("fill without auto colors = %v, want the theme's %v", got, dia.theme.ParticipantFill)
+	}
+	dia.SetAutoColors(true)
+	want := Palette(3)
+	for i, p := range dia.elemenets {
+		fill := mergeStyle(p.Style, Style{Fill: dia.themedParticipantFill(i)}).Fill
+		if p.Name == "B" && fill != (Color{255, 0, 0, 255}) {
+			t.Errorf("B's own fill was replaced by %v", fill)
+		} else if p.Name != "B" && fill != want[i] {
+			t.Errorf("%s fill = %v, want %v", p.Name, fill, want[i])
+		}
+	}
+}
+
+func TestColorHSLHSV(t *testing.T) {
+	tests := []struct {
+		c       Color
+		h, s, l float64
+		sv, v   float64
+	}{
+		{Color{255, 0, 0, 255}, 0, 100, 50, 100, 100},
+		{Color{0, 128, 0, 255}, 120, 100, 25.1, 100, 50.2},
+		{Color{255, 255, 255, 255}, 0, 0, 100, 0, 100},
+		{Color{0, 0, 0, 255}, 0, 0, 0, 0, 0},
+		{Color{70, 130, 180, 255}, 207.3, 44, 49, 61.1, 70.6},
+	}
+	near := func(a, b float64) bool { return math.Abs(a-b) < 0.1 }
+	for _, tt := range tests {
+		if h, s, l := tt.c.HSL(); !near(h, tt.h) || !near(s, tt.s) || !near(l, tt.l) {
+			t.Errorf("%v.HSL() = %.1f, %.1f, %.1f, want %g, %g, %g", tt.c, h, s, l, tt.h, tt.s, tt.l)
+		}
+		if h, s, v := tt.c.HSV(); !near(h, tt.h) || !near(s, tt.sv) || !near(v, tt.v) {
+			t.Errorf("%v.HSV() = %.1f, %.1f, %.1f, want %g, %g, %g", tt.c, h, s, v, tt.h, tt.sv, tt.v)
+		}
+		if got := ColorFromHSL(tt.c.HSL()); got != tt.c {
+			t.Errorf("ColorFromHSL(%v.HSL()) = %v", tt.c, got)
+		}
+		if got := ColorFromHSV(tt.c.HSV()); got != tt.c {
+			t.Errorf("ColorFromHSV(%v.HSV()) = %v", tt.c, got)
+		}
+	}
+	// hues wrap and out of range saturation and lightness are clamped
+	if got, want := ColorFromHSL(-240, 150, 50), (Color{0, 255, 0, 255}); got != want {
+		t.Errorf("ColorFromHSL(-240, 150, 50) = %v, want %v", got, want)
+	}
+}
+
+func TestColorAdjust(t *testing.T) {
+	steel := Color{70, 130, 180, 200}
+	tests := []struct {
+		name string
+		got  Color
+		want Color
+	}{
+		{"Lighten", steel.Lighten(20), Color{141, 179, 211, 200}},
+		{"Darken", steel.Darken(20), Color{41, 77, 107, 200}},
+		{"Darken past black", steel.Darken(80), Color{0, 0, 0, 200}},
+		{"Saturate", steel.Saturate(30), Color{33, 133, 218, 200}},
+		{"Desaturate", steel.Saturate(-100), Color{125, 125, 125, 200}},
+		{"Mix", Color{0, 0, 0, 255}.Mix(Color{255, 255, 255, 255}, 0.5), Color{128, 128, 128, 255}},
+		{"Mix none", steel.Mix(Color{255, 0, 0, 255}, -1), steel},
+		{"Mix all", steel.Mix(Color{255, 0, 0, 255}, 2), Color{255, 0, 0, 255}},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package zml
+
+import (
+	"log"
+)
+
+// DefaultMinContrast is the WCAG minimum contrast ratio for large text and
+// graphics; labels below it are redrawn in black or white
+const DefaultMinContrast = 3.0
+
+var (
+	black = Color{0, 0, 0, 255}
+	white = Color{255, 255, 255, 255}
+)
+
+// SetMinContrast sets the lowest contrast ratio, from 1 to 21, accepted
+// between a label and what it is drawn on; 0 turns the check off
+func (dia *Diagram) SetMinContrast(ratio float64) {
+	dia.minContrast = ratio
+}
+
+// readableText returns `text` when it contrasts enough with `fill`, and
+// otherwise warns once per color pair and returns black or white, whichever
+// reads better
+func (dia *Diagram) readableText(text, fill Color) Color {
+	if dia.minContrast <= 0 {
+		return text
+	}
+	if fill.Alpha < 255 {
+		// what shows through a translucent fill is the background
+		opaque := fill
+		opaque.Alpha = 255
+		fill = dia.bgColor.Mix(opaque, float64(fill.Alpha)/255)
+	}
+	ratio := text.ContrastRatio(fill)
+	if ratio >= dia.minContrast {
+		return text
+	}
+
+	readable := black
+	if white.ContrastRatio(fill) > black.ContrastRatio(fill) {
+		readable = white
+	}
+	pair := [2]Color{text, fill}
+	if !dia.contrastWarned[pair] {
+		if dia.contrastWarned == nil {
+			dia.contrastWarned = make(map[[2]Color]bool)
+		}
+		dia.contrastWarned[pair] = true
+		log.Printf("text %s on %s has a contrast of %.1f:1, below %g:1; using %s", text, fill, ratio, dia.minContrast, readable)
+	}
+	return readable
+}
@@ -0,0 +1,53 @@
+package zml
+
+import (
+	"math"
+	"testing"
+)
+
+func TestReadableText(t *testing.T) {
+	tests := []struct {
+		minContrast float64
+		text, fill  Color
+		want        Color
+	}{
+		// enough contrast, the text is kept
+		{DefaultMinContrast, black, white, black},
+		{DefaultMinContrast, white, Color{0, 0, 128, 255}, white},
+		// too little, black or white is used, whichever reads better
+		{DefaultMinContrast, white, Color{255, 255, 0, 255}, black},
+		{DefaultMinContrast, black, Color{0, 0, 128, 255}, white},
+		{DefaultMinContrast, Color{200, 200, 200, 255}, white, black},
+		// a translucent fill is seen over the white background
+		{DefaultMinContrast, white, Color{0, 0, 0, 20}, black},
+		// the check is off
+		{0, white, white, white},
+	}
+	for _, tt := range tests {
+		dia := NewDiagram("test")
+		dia.bgColor = white
+		dia.SetMinContrast(tt.minContrast)
+		if got := dia.readableText(tt.text, tt.fill); got != tt.want {
+			t.Errorf("readableText(%v, %v) at %g:1 = %v, want %v", tt.text, tt.fill, tt.minContrast, got, tt.want)
+		}
+	}
+}
+
+func TestContrastRatio(t *testing.T) {
+	tests := []struct {
+		a, b Color
+		want float64
+	}{
+		{black, white, 21},
+		{white, black, 21},
+		{white, white, 1},
+		{Color{119, 119, 119, 255}, white, 4.48},
+		{Color{255, 0, 0, 255}, white, 4.00},
+		{Color{0, 0, 255, 255}, black, 2.44},
+	}
+	for _, tt := range tests {
+		if got := tt.a.ContrastRatio(tt.b); math.Abs(got-tt.want) > 0.01 {
+			t.Errorf("%v.ContrastRatio(%v) = %.3f, want %.2f", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
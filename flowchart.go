@@ -0,0 +1,142 @@
+package zml
+
+import (
+	"log"
+	"math"
+	"regexp"
+	"strings"
+)
+
+var flowchartNodeTypes = map[string]int{
+	"node":     RECT,
+	"decision": DECISION,
+	"circle":   CIRCLE,
+}
+
+// processFlowchart parses the body of a flowchart. Nodes are created the
+// first time a link mentions them, or declared with a shape; subgraphs group
+// the nodes declared up to their `end` and can be linked like nodes:
+//
+//	direction LR
+//	subgraph pay: Payments
+//	    decision fraud: Looks legit?
+//	    fraud -> charge: yes
+//	end
+//	cart -> pay
+func (dia *Diagram) processFlowchart(lines []string) {
+	directionRegexp := regexp.MustCompile(`^direction\s+(LR|TB)$`)
+	subgraphRegexp := regexp.MustCompile(`^subgraph\s+([\w.-]+)\s*(?::\s*(.*))?$`)
+	nodeRegexp := regexp.MustCompile(`^(node|decision|circle)\s+([\w.-]+)\s*(?::\s*(.*))?$`)
+
+	var open []string
+	current := func() string {
+		if len(open) == 0 {
+			return ""
+		}
+		return open[len(open)-1]
+	}
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//") {
+			continue
+		}
+		if parts := directionRegexp.FindStringSubmatch(line); parts != nil {
+			dia.horizontal = parts[1] == "LR"
+			continue
+		}
+		if line == "end" {
+			if len(open) == 0 {
+				log.Printf("\"end\" without subgraph")
+				continue
+			}
+			open = open[:len(open)-1]
+			continue
+		}
+		if parts := subgraphRegexp.FindStringSubmatch(line); parts != nil {
+			if err := dia.AddNode(parts[1], strings.TrimSpace(parts[2]), BOUNDARY, current()); err != nil {
+				log.Printf(err.Error())
+				continue
+			}
+			open = append(open, parts[1])
+			continue
+		}
+		if parts := nodeRegexp.FindStringSubmatch(line); parts != nil {
+			if err := dia.AddNode(parts[2], strings.TrimSpace(parts[3]), flowchartNodeTypes[parts[1]], current()); err != nil {
+				log.Printf(err.Error())
+			}
+			continue
+		}
+		if parts := linkRegexp.FindStringSubmatch(line); parts != nil {
+			for _, id := range []string{parts[1], parts[3]} {
+				if _, ok := dia.nodes[id]; !ok {
+					dia.AddNode(id, "", RECT, current())
+				}
+			}
+		}
+		if !dia.processLink(line) {
+			log.Printf("unrecognised line: %s", line)
+		}
+	}
+}
+
+// sizeFlowchartNode sets the width and height of `n` from its shape and label
+func (dia *Diagram) sizeFlowchartNode(n *node) {
+	dia.useFont(dia.themedElementFont())
+	strWidth, strHeight := dia.measureText(n.Label)
+	switch n.Type {
+	case DECISION:
+		n.w = dia.decisionSize(n.Label)
+		n.h = n.w
+	case CIRCLE:
+		n.w = math.Max(elemenetBoxHeight, math.Max(strWidth, strHeight)+20)
+		n.h = n.w
+	default:
+		n.w = math.Max(elemenetBoxWidth, strWidth+elemenetsPadding)
+		n.h = math.Max(elemenetBoxHeight, strHeight+elemenetsPadding)
+	}
+}
+
+func (dia *Diagram) layoutFlowchart() (float64, float64) {
+	top := dia.top()
+	dia.layoutGroup(dia.root, dia.horizontal, dia.sizeFlowchartNode)
+	marginX := math.Max(elemenetsPadding, (float64(dia.dc.Width())-dia.root.w)/2)
+	placeNode(dia.root, marginX, top)
+	return dia.root.w + 2*marginX, dia.root.h + top + elemenetsPadding
+}
+
+func (dia *Diagram) renderFlowchart() {
+	dia.renderFlowchartNode(dia.root)
+	dia.renderLinks()
+}
+
+// renderFlowchartNode draws subgraphs before their members so members end up on top
+func (dia *Diagram) renderFlowchartNode(n *node) {
+	font := dia.themedElementFont()
+	dia.useFont(font)
+	if n.isGroup() {
+		if n.parent != nil {
+			dia.drawGroup(n, groupShade(dia.theme.Fragment, n), false)
+		}
+		for _, c := range n.children {
+			dia.renderFlowchartNode(c)
+		}
+		return
+	}
+
+	centerX, centerY := n.x+n.w/2, n.y+n.h/2
+	switch n.Type {
+	case DECISION:
+		dia.drawDecisionNode(centerX, n.y, dia.theme.ParticipantFill, n.Label)
+	case CIRCLE:
+		dia.dc.DrawCircle(centerX, centerY, n.w/2)
+		dia.setColor(dia.theme.ParticipantFill)
+		dia.dc.FillPreserve()
+		dia.setColor(dia.theme.ParticipantStroke)
+		dia.dc.SetLineWidth(lineStrokeWidth)
+		dia.dc.Stroke()
+		dia.setColor(dia.readableText(font.Color, dia.theme.ParticipantFill))
+		dia.drawText(n.Label, centerX, centerY, 0.5, 0.35)
+	default:
+		dia.drawBox(n.x, n.y, n.w, n.h, dia.theme.ParticipantFill, font.Color, n.Label)
+	}
+}
@@ -0,0 +1,93 @@
+package zml
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProcessFlowchart(t *testing.T) {
+	tests := []struct {
+		name       string
+		in         string
+		horizontal bool
+		nodes      map[string]graphNode
+		links      []string
+	}{
+		{
+			name: "subgraphs and shapes",
+			in: `title: Checkout
+type: flowchart
+node cart: Cart
+subgraph pay: Payments
+    decision fraud: Looks legit?
+    subgraph card: Card
+        circle charge: Charge
+        charge -> settle
+    end
+    fraud -> charge: yes
+end
+cart -> fraud
+fraud -> reject: no
+pay -> receipt
+end`,
+			nodes: map[string]graphNode{
+				"cart":    {"", RECT, "Cart"},
+				"pay":     {"", BOUNDARY, "Payments"},
+				"fraud":   {"pay", DECISION, "Looks legit?"},
+				"card":    {"pay", BOUNDARY, "Card"},
+				"charge":  {"card", CIRCLE, "Charge"},
+				"settle":  {"card", RECT, "settle"},
+				"reject":  {"", RECT, "reject"},
+				"receipt": {"", RECT, "receipt"},
+			},
+			links: []string{
+				"cart -> fraud: ",
+				"charge -> settle: ",
+				"fraud -> charge: yes",
+				"fraud -> reject: no",
+				"pay -> receipt: ",
+			},
+		},
+		{
+			// hyphens belong to names only between other characters, so
+			// arrows written without spaces still split the names
+			name: "hyphenated names",
+			in: `type: flowchart
+direction LR
+api-gw-->auth-svc
+auth-svc->>user.db: reads
+user.db--cache-1
+web-app -> api-gw`,
+			horizontal: true,
+			nodes: map[string]graphNode{
+				"api-gw":   {"", RECT, "api-gw"},
+				"auth-svc": {"", RECT, "auth-svc"},
+				"user.db":  {"", RECT, "user.db"},
+				"cache-1":  {"", RECT, "cache-1"},
+				"web-app":  {"", RECT, "web-app"},
+			},
+			links: []string{
+				"api-gw -> auth-svc: ",
+				"auth-svc -> user.db: reads",
+				"user.db -- cache-1: ",
+				"web-app -> api-gw: ",
+			},
+		},
+	}
+	for _, tt := range tests {
+		dia := NewDiagram("test")
+		dia.ProcessData([]byte(tt.in))
+		if dia.kind != FLOWCHART {
+			t.Fatalf("%s: kind = %s, want %s", tt.name, dia.kind, FLOWCHART)
+		}
+		if dia.horizontal != tt.horizontal {
+			t.Errorf("%s: horizontal = %t, want %t", tt.name, dia.horizontal, tt.horizontal)
+		}
+		if got := graphNodes(dia); !reflect.DeepEqual(got, tt.nodes) {
+			t.Errorf("%s: nodes = %v, want %v", tt.name, got, tt.nodes)
+		}
+		if got := graphLinks(dia); !reflect.DeepEqual(got, tt.links) {
+			t.Errorf("%s: links = %q, want %q", tt.name, got, tt.links)
+		}
+	}
+}
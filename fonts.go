@@ -0,0 +1,521 @@
+package zml
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gobolditalic"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/gomonobolditalic"
+	"golang.org/x/image/font/gofont/gomonoitalic"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// DefaultFontFamily is drawn with when a Font names no family, or one that
+// can't be found; it is embedded so output looks the same everywhere
+const DefaultFontFamily = "Go"
+
+// embeddedFonts holds the Go fonts by lower case family and style
+var embeddedFonts = map[string]map[string][]byte{
+	"go": {
+		"regular":     goregular.TTF,
+		"bold":        gobold.TTF,
+		"italic":      goitalic.TTF,
+		"bold italic": gobolditalic.TTF,
+	},
+	"go mono": {
+		"regular":     gomono.TTF,
+		"bold":        gomonobold.TTF,
+		"italic":      gomonoitalic.TTF,
+		"bold italic": gomonobolditalic.TTF,
+	},
+}
+
+// fontIndex maps lower case family names to styles to font files
+type fontIndex map[string]map[string]string
+
+// FontManager finds and parses font files once and caches their faces per
+// size. It is safe for concurrent use, so one manager can serve any number
+// of diagrams; NewDiagram uses DefaultFontManager.
+type FontManager struct {
+	mu      sync.Mutex
+	indexes map[string]fontIndex
+	fonts   map[string]*opentype.Font
+	// data holds the font files by source, for embedding in PDFs
+	data   map[string][]byte
+	faces  map[faceKey]*sharedFace
+	chains map[faceKey]*fallbackFace
+	// uncached reads and parses the font on every Face call and rasterizes
+	// every glyph, as diagrams did before sharing a manager, to measure the
+	// caches against
+	uncached bool
+}
+
+type faceKey struct {
+	source string
+	size   float64
+}
+
+// NewFontManager returns a FontManager with empty caches
+func NewFontManager() *FontManager {
+	return &FontManager{
+		indexes: map[string]fontIndex{},
+		fonts:   map[string]*opentype.Font{},
+		data:    map[string][]byte{},
+		faces:   map[faceKey]*sharedFace{},
+		chains:  map[faceKey]*fallbackFace{},
+	}
+}
+
+// DefaultFontManager is shared by all diagrams not given a manager of their own
+var DefaultFontManager = NewFontManager()
+
+// systemFontDirs returns the directories fonts are commonly installed in
+func systemFontDirs() []string {
+	home, _ := os.UserHomeDir()
+	switch runtime.GOOS {
+	case "windows":
+		return []string{filepath.Join(os.Getenv("WINDIR"), "Fonts"), filepath.Join(os.Getenv("LOCALAPPDATA"), "Microsoft", "Windows", "Fonts")}
+	case "darwin":
+		return []string{"/System/Library/Fonts", "/Library/Fonts", filepath.Join(home, "Library", "Fonts")}
+	default:
+		return []string{"/usr/share/fonts", "/usr/local/share/fonts", filepath.Join(home, ".fonts"), filepath.Join(home, ".local", "share", "fonts")}
+	}
+}
+
+// scanFonts indexes the .ttf and .otf files below `dirs` by the family and
+// style names in their name tables. Indexes are kept for the life of the
+// manager since reading every installed font is slow. m.mu must be held.
+func (m *FontManager) scanFonts(dirs ...string) fontIndex {
+	key := strings.Join(dirs, string(os.PathListSeparator))
+	if index, ok := m.indexes[key]; ok {
+		return index
+	}
+
+	index := fontIndex{}
+	var buf sfnt.Buffer
+	for _, dir := range dirs {
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			ext := strings.ToLower(filepath.Ext(path))
+			if err != nil || d.IsDir() || (ext != ".ttf" && ext != ".otf") {
+				return nil
+			}
+			file, err := os.Open(path)
+			if err != nil {
+				return nil
+			}
+			defer file.Close()
+			f, err := sfnt.ParseReaderAt(file)
+			if err != nil {
+				return nil
+			}
+			// typographic names group weights like "Light" under one family,
+			// the legacy names are the fallback
+			family, err := f.Name(&buf, sfnt.NameIDTypographicFamily)
+			if err != nil {
+				family, _ = f.Name(&buf, sfnt.NameIDFamily)
+			}
+			style, err := f.Name(&buf, sfnt.NameIDTypographicSubfamily)
+			if err != nil {
+				style, _ = f.Name(&buf, sfnt.NameIDSubfamily)
+			}
+			family = strings.ToLower(strings.TrimSpace(family))
+			if family == "" {
+				return nil
+			}
+			if index[family] == nil {
+				index[family] = map[string]string{}
+			}
+			if _, ok := index[family][normalizeFontStyle(style)]; !ok {
+				index[family][normalizeFontStyle(style)] = path
+			}
+			return nil
+		})
+	}
+	m.indexes[key] = index
+	return index
+}
+
+// normalizeFontStyle turns style names like "Bold Oblique", "BoldItalic" or
+// "Book" into the forms used as index keys: "bold italic" and "regular"
+func normalizeFontStyle(style string) string {
+	style = strings.ToLower(style)
+	bold := strings.Contains(style, "bold")
+	italic := strings.Contains(style, "italic") || strings.Contains(style, "oblique")
+	var words []string
+	for _, word := range strings.FieldsFunc(style, func(r rune) bool { return r == ' ' || r == '-' || r == '_' }) {
+		switch {
+		case word == "regular", word == "normal", word == "book", word == "roman",
+			strings.Contains(word, "bold"), strings.Contains(word, "italic"), strings.Contains(word, "oblique"):
+		default:
+			words = append(words, word)
+		}
+	}
+	if bold {
+		words = append(words, "bold")
+	}
+	if italic {
+		words = append(words, "italic")
+	}
+	if len(words) == 0 {
+		return "regular"
+	}
+	return strings.Join(words, " ")
+}
+
+// pickStyle returns the file of `styles` for `style`, falling back to the
+// regular face and then to any face of the family
+func pickStyle(styles map[string]string, style string) (string, bool) {
+	if path, ok := styles[normalizeFontStyle(style)]; ok {
+		return path, true
+	}
+	if path, ok := styles["regular"]; ok {
+		return path, true
+	}
+	names := make([]string, 0, len(styles))
+	for name := range styles {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return "", false
+	}
+	sort.Strings(names)
+	return styles[names[0]], true
+}
+
+// ParseFont reads a font spec: "Family[, Fallback...][:style][:size]", e.g.
+// "Noto Sans:bold:14" or "Go Mono, Noto Sans CJK JP:12", or the file name
+// form "NotoSans-Bold.ttf,14"
+func ParseFont(spec string) (Font, error) {
+	var f Font
+	families, rest, _ := strings.Cut(spec, ":")
+	if name, size, ok := strings.Cut(spec, ","); ok {
+		if _, err := strconv.ParseFloat(strings.TrimSpace(size), 64); err == nil {
+			families, rest = name, size
+		}
+	}
+	for i, family := range strings.Split(families, ",") {
+		if i == 0 {
+			f.Name = strings.TrimSpace(family)
+		} else if family = strings.TrimSpace(family); family != "" {
+			f.Fallback = append(f.Fallback, family)
+		}
+	}
+	for _, part := range strings.Split(rest, ":") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if size, err := strconv.ParseFloat(part, 64); err == nil {
+			if size <= 0 {
+				return f, fmt.Errorf("font size must be positive, got %s", part)
+			}
+			f.Size = size
+		} else {
+			f.Style = part
+		}
+	}
+	return f, nil
+}
+
+// source finds the font file for `f`: a file when Name ends in .ttf or
+// .otf, looked up in `fontDir` when relative, otherwise the family Name
+// looked up among the embedded fonts, `fontDir` and the system font
+// directories. Embedded fonts are returned as "embedded:<family>:<style>".
+// m.mu must be held.
+func (m *FontManager) source(f Font, fontDir string) (string, error) {
+	family := strings.ToLower(f.Name)
+	if family == "" {
+		family = strings.ToLower(DefaultFontFamily)
+	}
+	if ext := filepath.Ext(family); ext == ".ttf" || ext == ".otf" {
+		if !filepath.IsAbs(f.Name) && fontDir != "" {
+			return filepath.Join(fontDir, f.Name), nil
+		}
+		return f.Name, nil
+	}
+
+	if styles, ok := embeddedFonts[family]; ok {
+		style := normalizeFontStyle(f.Style)
+		if _, ok := styles[style]; !ok {
+			style = "regular"
+		}
+		return "embedded:" + family + ":" + style, nil
+	}
+	var indexes []fontIndex
+	if fontDir != "" {
+		indexes = append(indexes, m.scanFonts(fontDir))
+	}
+	indexes = append(indexes, m.scanFonts(systemFontDirs()...))
+	for _, index := range indexes {
+		if path, ok := pickStyle(index[family], f.Style); ok {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("font family \"%s\" not found", f.Name)
+}
+
+// parse returns the parsed font at `source`, reading it only the first
+// time. m.mu must be held.
+func (m *FontManager) parse(source string) (*opentype.Font, error) {
+	if parsed, ok := m.fonts[source]; ok {
+		return parsed, nil
+	}
+	var data []byte
+	if embedded := strings.SplitN(source, ":", 3); len(embedded) == 3 && embedded[0] == "embedded" {
+		data = embeddedFonts[embedded[1]][embedded[2]]
+	} else {
+		var err error
+		if data, err = os.ReadFile(source); err != nil {
+			return nil, err
+		}
+	}
+	parsed, err := opentype.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+	m.fonts[source] = parsed
+	m.data[source] = data
+	return parsed, nil
+}
+
+// Face returns a face for `f`, with relative file names and unknown
+// families looked up in `fontDir` first. When `f` has a Fallback list,
+// runes missing from its font are drawn and measured with the first
+// fallback that has them; fallbacks that can't be found are skipped.
+func (m *FontManager) Face(f Font, fontDir string) (font.Face, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	primary, err := m.face(f, fontDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(f.Fallback) == 0 {
+		return primary, nil
+	}
+
+	key := faceKey{primary.source + "|" + strings.Join(f.Fallback, "|"), f.Size}
+	if chain, ok := m.chains[key]; ok {
+		return chain, nil
+	}
+	chain := &fallbackFace{faces: []*sharedFace{primary}}
+	for _, name := range f.Fallback {
+		face, err := m.face(Font{Name: name, Style: f.Style, Size: f.Size}, fontDir)
+		if err != nil {
+			log.Printf("fallback %s", err.Error())
+			continue
+		}
+		chain.faces = append(chain.faces, face)
+	}
+	m.chains[key] = chain
+	return chain, nil
+}
+
+// face returns the cached face of `f`'s font at `f.Size`. m.mu must be held.
+func (m *FontManager) face(f Font, fontDir string) (*sharedFace, error) {
+	source, err := m.source(f, fontDir)
+	if err != nil {
+		return nil, err
+	}
+	key := faceKey{source, f.Size}
+	if face, ok := m.faces[key]; ok && !m.uncached {
+		return face, nil
+	}
+	if m.uncached {
+		delete(m.fonts, source)
+	}
+	parsed, err := m.parse(source)
+	if err != nil {
+		return nil, err
+	}
+	face, err := opentype.NewFace(parsed, &opentype.FaceOptions{Size: f.Size, DPI: 72, Hinting: font.HintingNone})
+	if err != nil {
+		return nil, err
+	}
+	m.faces[key] = &sharedFace{face: face, font: parsed, source: source, data: m.data[source], size: f.Size, uncached: m.uncached}
+	return m.faces[key], nil
+}
+
+// sharedFace serializes the use of a face by diagrams drawing concurrently
+// and caches glyph masks, which otherwise are rasterized on every draw. A
+// mask depends on the rune and on where the dot falls within a pixel, which
+// is rounded to a quarter pixel so a glyph has at most 16 masks.
+type sharedFace struct {
+	mu     sync.Mutex
+	face   font.Face
+	font   *opentype.Font
+	source string
+	data   []byte
+	size   float64
+	buf    sfnt.Buffer
+	glyphs map[glyphKey]cachedGlyph
+	// uncached skips the glyph cache, see FontManager
+	uncached bool
+}
+
+type glyphKey struct {
+	r      rune
+	dx, dy fixed.Int26_6
+}
+
+type cachedGlyph struct {
+	// dr is relative to the pixel the dot is in
+	dr      image.Rectangle
+	mask    *image.Alpha
+	advance fixed.Int26_6
+	ok      bool
+}
+
+func (s *sharedFace) Close() error {
+	return nil
+}
+
+func (s *sharedFace) Glyph(dot fixed.Point26_6, r rune) (image.Rectangle, image.Image, image.Point, fixed.Int26_6, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.uncached {
+		return s.face.Glyph(dot, r)
+	}
+	key := glyphKey{r, dot.X & 48, dot.Y & 48}
+	pixel := image.Point{dot.X.Floor(), dot.Y.Floor()}
+	if g, ok := s.glyphs[key]; ok {
+		return g.dr.Add(pixel), g.mask, image.Point{}, g.advance, g.ok
+	}
+
+	dr, mask, maskp, advance, ok := s.face.Glyph(fixed.Point26_6{X: dot.X&^63 | key.dx, Y: dot.Y&^63 | key.dy}, r)
+	// the face reuses its mask for the next glyph, the cache keeps a copy
+	copied := image.NewAlpha(image.Rect(0, 0, dr.Dx(), dr.Dy()))
+	if ok && mask != nil {
+		draw.Draw(copied, copied.Bounds(), mask, maskp, draw.Src)
+	}
+	if s.glyphs == nil {
+		s.glyphs = make(map[glyphKey]cachedGlyph)
+	}
+	s.glyphs[key] = cachedGlyph{dr.Sub(pixel), copied, advance, ok}
+	return dr, copied, image.Point{}, advance, ok
+}
+
+// has reports whether the font has a glyph for `r`, rather than drawing it
+// as the missing glyph box
+func (s *sharedFace) has(r rune) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	index, err := s.font.GlyphIndex(&s.buf, r)
+	return err == nil && index != 0
+}
+
+func (s *sharedFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.face.GlyphBounds(r)
+}
+
+func (s *sharedFace) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.face.GlyphAdvance(r)
+}
+
+func (s *sharedFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.face.Kern(r0, r1)
+}
+
+func (s *sharedFace) Metrics() font.Metrics {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.face.Metrics()
+}
+
+// fallbackFace draws each rune with the first of its faces that has a glyph
+// for it, or with the first face when none has
+type fallbackFace struct {
+	faces []*sharedFace
+}
+
+func (f *fallbackFace) pick(r rune) *sharedFace {
+	for _, face := range f.faces {
+		if face.has(r) {
+			return face
+		}
+	}
+	return f.faces[0]
+}
+
+func (f *fallbackFace) Close() error {
+	return nil
+}
+
+func (f *fallbackFace) Glyph(dot fixed.Point26_6, r rune) (image.Rectangle, image.Image, image.Point, fixed.Int26_6, bool) {
+	return f.pick(r).Glyph(dot, r)
+}
+
+func (f *fallbackFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+	return f.pick(r).GlyphBounds(r)
+}
+
+func (f *fallbackFace) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+	return f.pick(r).GlyphAdvance(r)
+}
+
+// Kern only applies between runes drawn with the same face
+func (f *fallbackFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	if face := f.pick(r0); face == f.pick(r1) {
+		return face.Kern(r0, r1)
+	}
+	return 0
+}
+
+// Metrics are the first face's, so lines keep their height whatever
+// fallbacks they use
+func (f *fallbackFace) Metrics() font.Metrics {
+	return f.faces[0].Metrics()
+}
+
+// SetFontManager makes the diagram load its fonts through `m`, e.g. one
+// manager shared by the diagrams of a server
+func (dia *Diagram) SetFontManager(m *FontManager) {
+	dia.fontManager = m
+}
+
+// useFont makes `f` the font of the drawing context, falling back to the
+// embedded default font when it can't be loaded
+func (dia *Diagram) useFont(f Font) {
+	dia.currentFont = f
+	if dc, ok := dia.dc.(*rasterCanvas); ok {
+		f.Size *= dc.scale
+	}
+	face, err := dia.fontManager.Face(f, dia.fontDir)
+	if err != nil {
+		if !dia.fontWarned[f.Name] {
+			if dia.fontWarned == nil {
+				dia.fontWarned = make(map[string]bool)
+			}
+			dia.fontWarned[f.Name] = true
+			log.Printf("%s, using %s", err.Error(), DefaultFontFamily)
+		}
+		if face, err = dia.fontManager.Face(Font{Style: f.Style, Size: f.Size}, ""); err != nil {
+			log.Printf(err.Error())
+			return
+		}
+	}
+	dia.dc.SetFontFace(face)
+}
@@ -0,0 +1,289 @@
+package zml
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/math/fixed"
+)
+
+func TestParseFont(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Font
+		wantErr bool
+	}{
+		{"Noto Sans:bold:14", Font{Name: "Noto Sans", Style: "bold", Size: 14}, false},
+		{"Go:12", Font{Name: "Go", Size: 12}, false},
+		{"Go:bold italic", Font{Name: "Go", Style: "bold italic"}, false},
+		{" Go Mono , Noto Sans CJK JP :12", Font{Name: "Go Mono", Fallback: []string{"Noto Sans CJK JP"}, Size: 12}, false},
+		{"NotoSans-Bold.ttf,37", Font{Name: "NotoSans-Bold.ttf", Size: 37}, false},
+		{"/fonts/Custom.otf:10.5", Font{Name: "/fonts/Custom.otf", Size: 10.5}, false},
+		{"Go:0", Font{Name: "Go"}, true},
+		{"Go:-3", Font{Name: "Go"}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseFont(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseFont(%q): error %v, want error %t", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseFont(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeFontStyle(t *testing.T) {
+	for in, want := range map[string]string{
+		"":               "regular",
+		"Book":           "regular",
+		"Bold":           "bold",
+		"BoldItalic":     "bold italic",
+		"Bold Oblique":   "bold italic",
+		"italic bold":    "bold italic",
+		"Light":          "light",
+		"SemiBold":       "bold",
+		"Condensed_Bold": "condensed bold",
+	} {
+		if got := normalizeFontStyle(in); got != want {
+			t.Errorf("normalizeFontStyle(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestFontSource(t *testing.T) {
+	fontDir := t.TempDir()
+	for name, data := range map[string][]byte{"a.ttf": goregular.TTF, "sub/b.ttf": gobold.TTF, "notes.txt": []byte("not a font")} {
+		os.MkdirAll(filepath.Dir(filepath.Join(fontDir, name)), 0o755)
+		if err := os.WriteFile(filepath.Join(fontDir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := NewFontManager()
+	tests := []struct {
+		f    Font
+		want string
+	}{
+		{Font{}, "embedded:go:regular"},
+		{Font{Name: "GO MONO", Style: "Bold Oblique"}, "embedded:go mono:bold italic"},
+		// styles the embedded family doesn't have fall back to regular
+		{Font{Name: "Go", Style: "light"}, "embedded:go:regular"},
+		{Font{Name: "Custom.ttf"}, filepath.Join(fontDir, "Custom.ttf")},
+		{Font{Name: "/abs/Custom.otf"}, "/abs/Custom.otf"},
+	}
+	for _, tt := range tests {
+		got, err := m.source(tt.f, fontDir)
+		if err != nil || got != tt.want {
+			t.Errorf("source(%+v) = %q, %v, want %q", tt.f, got, err, tt.want)
+		}
+	}
+	if got, err := m.source(Font{Name: "No Such Family"}, fontDir); err == nil {
+		t.Errorf("source of an unknown family = %q, want an error", got)
+	}
+
+	// the font dir is indexed by the names inside the files
+	index := m.scanFonts(fontDir)
+	want := fontIndex{"go": {"regular": filepath.Join(fontDir, "a.ttf"), "bold": filepath.Join(fontDir, "sub", "b.ttf")}}
+	if !reflect.DeepEqual(index, want) {
+		t.Errorf("scanFonts(%s) = %v, want %v", fontDir, index, want)
+	}
+	for style, want := range map[string]string{"bold": "sub/b.ttf", "italic": "a.ttf", "": "a.ttf"} {
+		if got, ok := pickStyle(index["go"], style); !ok || got != filepath.Join(fontDir, want) {
+			t.Errorf("pickStyle(%q) = %q, %t, want %s", style, got, ok, want)
+		}
+	}
+	if got, ok := pickStyle(map[string]string{"light": "l.ttf", "black": "k.ttf"}, "bold"); !ok || got != "k.ttf" {
+		t.Errorf("pickStyle of a family with no regular face = %q, %t, want the first by name", got, ok)
+	}
+}
+
+// longSequence returns a sequence diagram of `n` messages between a few
+// participants
+func longSequence(n int) []byte {
+	participants := []string{"Browser", "Gateway", "Auth", "Orders", "Ledger", "Mailer"}
+	var b strings.Builder
+	b.WriteString("title: A long conversation\n")
+	for i := 0; i < n; i++ {
+		from := participants[i%len(participants)]
+		to := participants[(i*5+1)%len(participants)]
+		fmt.Fprintf(&b, "%s->>%s: message %d with a few more words\n", from, to, i)
+	}
+	return []byte(b.String())
+}
+
+// BenchmarkRenderSequence renders 300 messages with fonts read from a font
+// dir, as `--font-dir` does, through a manager that caches faces and glyph
+// masks and through one that reads, parses and rasterizes on every use
+func BenchmarkRenderSequence(b *testing.B) {
+	fontDir := b.TempDir()
+	if err := os.WriteFile(filepath.Join(fontDir, "Go-Regular.ttf"), goregular.TTF, 0o644); err != nil {
+		b.Fatal(err)
+	}
+	data := longSequence(300)
+	for _, uncached := range []bool{false, true} {
+		name := "cached"
+		if uncached {
+			name = "uncached"
+		}
+		b.Run(name, func(b *testing.B) {
+			m := NewFontManager()
+			m.uncached = uncached
+			dir := b.TempDir()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				dia := NewDiagram(filepath.Join(dir, "long"))
+				dia.SetFontManager(m)
+				dia.SetFontDir(fontDir)
+				dia.SetTitleFont(Font{Name: "Go-Regular.ttf", Size: 30})
+				dia.SetLabelFont(Font{Name: "Go-Regular.ttf", Size: 14})
+				dia.SetElementLabelFont(Font{Name: "Go-Regular.ttf", Size: 18})
+				dia.ProcessData(data)
+				dia.Render(1024, 1024, "")
+			}
+		})
+	}
+}
+
+// glyphResult is what drawing one glyph returned, with the mask copied out
+type glyphResult struct {
+	dr      image.Rectangle
+	pix     []uint8
+	advance fixed.Int26_6
+	ok      bool
+}
+
+func drawGlyph(face font.Face, dot fixed.Point26_6, r rune) glyphResult {
+	dr, mask, maskp, advance, ok := face.Glyph(dot, r)
+	res := glyphResult{dr: dr, advance: advance, ok: ok}
+	if mask != nil {
+		for y := 0; y < dr.Dy(); y++ {
+			for x := 0; x < dr.Dx(); x++ {
+				_, _, _, a := mask.At(maskp.X+x, maskp.Y+y).RGBA()
+				res.pix = append(res.pix, uint8(a>>8))
+			}
+		}
+	}
+	return res
+}
+
+// TestFontManagerConcurrent loads faces and draws glyphs from several
+// goroutines sharing a manager, as diagrams rendered in parallel do; run it
+// with -race
+func TestFontManagerConcurrent(t *testing.T) {
+	fonts := []Font{
+		{Name: "Go", Size: 14},
+		{Name: "Go", Style: "bold", Size: 14},
+		{Name: "Go", Size: 21},
+		{Name: "Go Mono", Size: 14, Fallback: []string{"Go"}},
+	}
+	text := "Sequence → diagrams, 0123456789"
+	dots := []fixed.Point26_6{{X: 640, Y: 1280}, {X: 656, Y: 1296}, {X: 680, Y: 1304}}
+
+	// what a manager of its own draws, one font at a time
+	want := map[int][]glyphResult{}
+	for i, f := range fonts {
+		face, err := NewFontManager().Face(f, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, dot := range dots {
+			for _, r := range text {
+				want[i] = append(want[i], drawGlyph(face, dot, r))
+			}
+		}
+	}
+
+	m := NewFontManager()
+	var wg sync.WaitGroup
+	errs := make(chan error, 8*len(fonts))
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for n := range fonts {
+				i := (g + n) % len(fonts)
+				face, err := m.Face(fonts[i], "")
+				if err != nil {
+					errs <- err
+					return
+				}
+				var got []glyphResult
+				for _, dot := range dots {
+					for _, r := range text {
+						face.GlyphAdvance(r)
+						face.Kern('A', r)
+						face.Metrics()
+						got = append(got, drawGlyph(face, dot, r))
+					}
+				}
+				if !reflect.DeepEqual(got, want[i]) {
+					errs <- fmt.Errorf("goroutine %d drew %s:%s:%.0f differently", g, fonts[i].Name, fonts[i].Style, fonts[i].Size)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestFallbackFace(t *testing.T) {
+	const dejaVu = "/usr/share/fonts/truetype/dejavu"
+	m := NewFontManager()
+	face, err := m.Face(Font{Name: "Go", Size: 14, Fallback: []string{"No Such Family", "DejaVu Sans"}}, dejaVu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, ok := face.(*fallbackFace)
+	if !ok {
+		t.Fatalf("Face with fallbacks returned a %T", face)
+	}
+	if len(chain.faces) < 2 {
+		t.Skipf("DejaVu Sans isn't installed in %s", dejaVu)
+	}
+	if len(chain.faces) != 2 || chain.faces[1].source != filepath.Join(dejaVu, "DejaVuSans.ttf") {
+		t.Fatalf("chain of %d faces, the missing family should be skipped", len(chain.faces))
+	}
+	again, _ := m.Face(Font{Name: "Go", Size: 14, Fallback: []string{"No Such Family", "DejaVu Sans"}}, dejaVu)
+	if again != face {
+		t.Errorf("the chain isn't cached")
+	}
+
+	goFace, dejaVuFace := chain.faces[0], chain.faces[1]
+	// Go has Latin, DejaVu Sans has Hebrew, neither has Han
+	for r, want := range map[rune]*sharedFace{'A': goFace, 'é': goFace, 'א': dejaVuFace, '中': goFace} {
+		if got := chain.pick(r); got != want {
+			t.Errorf("%c is drawn with %s, want %s", r, got.source, want.source)
+		}
+	}
+	if adv, ok := chain.GlyphAdvance('א'); !ok || adv != mustAdvance(t, dejaVuFace, 'א') {
+		t.Errorf("advance of א = %v, %t, want DejaVu's", adv, ok)
+	}
+	if chain.Metrics() != goFace.Metrics() {
+		t.Errorf("the chain's metrics aren't its first face's")
+	}
+	if k := chain.Kern('A', 'א'); k != 0 {
+		t.Errorf("kerning across faces = %v, want 0", k)
+	}
+}
+
+func mustAdvance(t *testing.T, face font.Face, r rune) fixed.Int26_6 {
+	t.Helper()
+	adv, ok := face.GlyphAdvance(r)
+	if !ok {
+		t.Fatalf("no advance for %c", r)
+	}
+	return adv
+}
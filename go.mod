@@ -4,12 +4,16 @@ go 1.19
 
 require (
 	github.com/fogleman/gg v1.3.0
+	github.com/jung-kurt/gofpdf v1.16.2
+	github.com/rivo/uniseg v0.4.7
 	github.com/urfave/cli v1.22.14
+	golang.org/x/image v0.11.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/cpuguy83/go-md2man/v2 v2.0.2 // indirect
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
 	github.com/russross/blackfriday/v2 v2.1.0 // indirect
-	golang.org/x/image v0.11.0 // indirect
+	golang.org/x/text v0.12.0 // indirect
 )
@@ -0,0 +1,315 @@
+package zml
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	groupPadding = 20.0
+	nodeSpacing  = 40.0
+	rankSpacing  = 80.0
+)
+
+// childAncestor returns the ancestor of `n` (or `n` itself) that is a direct
+// child of `group`, nil when `n` is not inside `group`
+func childAncestor(group, n *node) *node {
+	for n != nil && n.parent != group {
+		n = n.parent
+	}
+	return n
+}
+
+// rankChildren splits the children of `group` into ranks using the longest
+// path over the links between them; links into or out of a child's
+// descendants count as links of the child, so members stay together.
+// Back edges are ignored, cycles don't prevent ranking.
+func (dia *Diagram) rankChildren(group *node) [][]*node {
+	children := group.children
+	index := make(map[*node]int, len(children))
+	for i, c := range children {
+		index[c] = i
+	}
+	succ := make([][]int, len(children))
+	for _, l := range dia.links {
+		from := childAncestor(group, l.from)
+		to := childAncestor(group, l.to)
+		if from == nil || to == nil || from == to {
+			continue
+		}
+		succ[index[from]] = append(succ[index[from]], index[to])
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make([]int, len(children))
+	dag := make([][]int, len(children))
+	var order []int
+	var visit func(v int)
+	visit = func(v int) {
+		state[v] = visiting
+		for _, w := range succ[v] {
+			if state[w] == visiting {
+				continue
+			}
+			dag[v] = append(dag[v], w)
+			if state[w] == unvisited {
+				visit(w)
+			}
+		}
+		state[v] = done
+		order = append(order, v)
+	}
+	for v := range children {
+		if state[v] == unvisited {
+			visit(v)
+		}
+	}
+
+	rank := make([]int, len(children))
+	maxRank := 0
+	for i := len(order) - 1; i >= 0; i-- {
+		v := order[i]
+		for _, w := range dag[v] {
+			if rank[v]+1 > rank[w] {
+				rank[w] = rank[v] + 1
+			}
+		}
+	}
+	for _, r := range rank {
+		if r > maxRank {
+			maxRank = r
+		}
+	}
+
+	ranks := make([][]*node, maxRank+1)
+	position := make([]float64, len(children))
+	for v, r := range rank {
+		position[v] = float64(len(ranks[r]))
+		ranks[r] = append(ranks[r], children[v])
+	}
+
+	// order each rank by the mean position of its predecessors to cut crossings
+	for r := 1; r < len(ranks); r++ {
+		barycenter := make(map[*node]float64, len(ranks[r]))
+		for _, c := range ranks[r] {
+			sum, count := 0.0, 0.0
+			for v, targets := range dag {
+				for _, w := range targets {
+					if children[w] == c && rank[v] < r {
+						sum += position[v]
+						count++
+					}
+				}
+			}
+			if count > 0 {
+				barycenter[c] = sum / count
+			} else {
+				barycenter[c] = position[index[c]]
+			}
+		}
+		sort.SliceStable(ranks[r], func(i, j int) bool {
+			return barycenter[ranks[r][i]] < barycenter[ranks[r][j]]
+		})
+		for i, c := range ranks[r] {
+			position[index[c]] = float64(i)
+		}
+	}
+	return ranks
+}
+
+// layoutGroup sizes `group` and positions its children relative to its top
+// left corner. Leaves are sized by `sizeLeaf`. Ranks become columns when
+// `horizontal` is set, rows otherwise.
+func (dia *Diagram) layoutGroup(group *node, horizontal bool, sizeLeaf func(*node)) {
+	if !group.isGroup() {
+		sizeLeaf(group)
+		return
+	}
+	for _, c := range group.children {
+		dia.layoutGroup(c, horizontal, sizeLeaf)
+	}
+
+	padding, header, labelWidth := 0.0, 0.0, 0.0
+	if group.parent != nil {
+		padding = groupPadding
+		if group.Label != "" {
+			dia.useFont(dia.themedElementFont())
+			w, h := dia.measureText(group.Label)
+			labelWidth = w
+			header = h + 10
+		}
+	}
+
+	ranks := dia.rankChildren(group)
+	// main is the extent along the rank direction, cross across it
+	mainSizes := make([]float64, len(ranks))
+	crossSizes := make([]float64, len(ranks))
+	for r, members := range ranks {
+		for i, c := range members {
+			mainSize, crossSize := c.w, c.h
+			if !horizontal {
+				mainSize, crossSize = c.h, c.w
+			}
+			mainSizes[r] = math.Max(mainSizes[r], mainSize)
+			crossSizes[r] += crossSize
+			if i > 0 {
+				crossSizes[r] += nodeSpacing
+			}
+		}
+	}
+	contentMain, contentCross := 0.0, 0.0
+	for r := range ranks {
+		contentMain += mainSizes[r]
+		if r > 0 {
+			contentMain += rankSpacing
+		}
+		contentCross = math.Max(contentCross, crossSizes[r])
+	}
+
+	mainOffset := 0.0
+	for r, members := range ranks {
+		crossOffset := (contentCross - crossSizes[r]) / 2
+		for _, c := range members {
+			if horizontal {
+				c.x = padding + mainOffset + (mainSizes[r]-c.w)/2
+				c.y = padding + header + crossOffset
+				crossOffset += c.h + nodeSpacing
+			} else {
+				c.x = padding + crossOffset
+				c.y = padding + header + mainOffset + (mainSizes[r]-c.h)/2
+				crossOffset += c.w + nodeSpacing
+			}
+		}
+		mainOffset += mainSizes[r] + rankSpacing
+	}
+
+	contentWidth, contentHeight := contentMain, contentCross
+	if !horizontal {
+		contentWidth, contentHeight = contentCross, contentMain
+	}
+	group.w = math.Max(contentWidth, labelWidth) + 2*padding
+	group.h = contentHeight + header + 2*padding
+	if labelWidth > contentWidth {
+		for _, c := range group.children {
+			c.x += (labelWidth - contentWidth) / 2
+		}
+	}
+}
+
+// placeNode turns the relative child positions computed by layoutGroup into
+// canvas coordinates, with `n` at (x, y)
+func placeNode(n *node, x, y float64) {
+	n.x, n.y = x, y
+	for _, c := range n.children {
+		placeNode(c, x+c.x, y+c.y)
+	}
+}
+
+// borderPoint returns where the line from the center of `n` towards
+// (toX, toY) crosses the border of `n`
+func borderPoint(n *node, toX, toY float64) (float64, float64) {
+	cx, cy := n.x+n.w/2, n.y+n.h/2
+	dx, dy := toX-cx, toY-cy
+	if dx == 0 && dy == 0 {
+		return cx, cy
+	}
+	scale := math.Inf(1)
+	if dx != 0 {
+		scale = math.Min(scale, (n.w/2)/math.Abs(dx))
+	}
+	if dy != 0 {
+		scale = math.Min(scale, (n.h/2)/math.Abs(dy))
+	}
+	return cx + dx*scale, cy + dy*scale
+}
+
+// drawArrowHead draws an arrow tip at (toX, toY) for a line coming from (fromX, fromY)
+func (dia *Diagram) drawArrowHead(fromX, fromY, toX, toY float64) {
+	angle := math.Atan2(toY-fromY, toX-fromX)
+	for _, side := range []float64{-math.Pi / 4, math.Pi / 4} {
+		dia.dc.DrawLine(toX, toY, toX-14*math.Cos(angle+side), toY-14*math.Sin(angle+side))
+	}
+	dia.dc.Stroke()
+}
+
+// drawLinkLabel draws `label` centered on (x, y) over a background patch
+func (dia *Diagram) drawLinkLabel(label string, x, y float64, bgColor Color) {
+	font := dia.themedLabelFont()
+	dia.useFont(font)
+	textWidth, textHeight := dia.measureText(label)
+	dia.dc.DrawRectangle(x-textWidth/2-3, y-textHeight/2-3, textWidth+6, textHeight+6)
+	dia.setColor(bgColor)
+	dia.dc.Fill()
+	dia.setColor(dia.readableText(font.Color, bgColor))
+	dia.drawText(label, x, y, 0.5, 0.35)
+}
+
+// drawPath strokes a polyline, with an arrow tip at its end when `directional`
+func (dia *Diagram) drawPath(points []point, directional bool) {
+	if len(points) < 2 {
+		return
+	}
+	dia.dc.MoveTo(points[0].X, points[0].Y)
+	for _, p := range points[1:] {
+		dia.dc.LineTo(p.X, p.Y)
+	}
+	dia.dc.Stroke()
+	if directional {
+		last := len(points) - 1
+		dia.drawArrowHead(points[last-1].X, points[last-1].Y, points[last].X, points[last].Y)
+	}
+}
+
+// groupShade returns the fill of group `n`, stepping `base` away from the
+// background for each group it is nested in so nesting stays visible
+func groupShade(base Color, n *node) Color {
+	depth := 0.0
+	for p := n.parent; p != nil && p.parent != nil; p = p.parent {
+		depth++
+	}
+	if base.Luminance() > 0.5 {
+		return base.Darken(4 * depth)
+	}
+	return base.Lighten(4 * depth)
+}
+
+// drawGroup draws the background region of a boundary or subgraph with its
+// label in the top left corner
+func (dia *Diagram) drawGroup(n *node, bgColor Color, dashed bool) {
+	dia.dc.DrawRoundedRectangle(n.x, n.y, n.w, n.h, 8)
+	dia.setColor(bgColor)
+	dia.dc.FillPreserve()
+	dia.setColor(dia.theme.FragmentStroke)
+	dia.dc.SetLineWidth(rectangleStrokeWidth)
+	if dashed {
+		dia.dc.SetDash(6)
+	}
+	dia.dc.Stroke()
+	dia.dc.SetDash()
+	dia.setColor(dia.readableText(dia.theme.FragmentStroke, bgColor))
+	dia.drawText(n.Label, n.x+groupPadding, n.y+groupPadding/2, 0, 1)
+}
+
+// renderLinks draws the links of a hierarchical diagram, routed according
+// to the edge style
+func (dia *Diagram) renderLinks() {
+	paths := dia.routeLinks()
+	dia.setColor(dia.theme.Arrow)
+	dia.dc.SetLineWidth(lineStrokeWidth)
+	for i, l := range dia.links {
+		if dia.edgeStyle == SPLINE {
+			dia.drawSpline(paths[i], l.directional)
+		} else {
+			dia.drawPath(paths[i], l.directional)
+		}
+	}
+	for i, center := range dia.placeLabels(paths) {
+		if dia.links[i].Label != "" {
+			dia.drawLinkLabel(dia.links[i].Label, center.X, center.Y, dia.theme.Note)
+		}
+	}
+}
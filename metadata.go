@@ -0,0 +1,180 @@
+package zml
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	// Version is the version of zml recorded in the images it writes
+	Version = "0.21.3"
+
+	// sourceKeyword names the PNG text chunk holding a diagram's ZML source
+	sourceKeyword = "zml"
+	// hashKeyword names the PNG text chunk holding the SourceHash of the
+	// diagram's ZML source
+	hashKeyword = "zml-sha256"
+	// softwareKeyword names the PNG text chunk holding the program that
+	// wrote the image
+	softwareKeyword = "Software"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// itxtChunk returns an international text chunk of `keyword`, with `text`
+// zlib compressed when `compress` is set
+func itxtChunk(keyword, text string, compress bool) pngChunk {
+	data := append([]byte(keyword), 0)
+	if !compress {
+		// no compression, no language tag nor translated keyword
+		return pngChunk{kind: "iTXt", data: append(append(data, 0, 0, 0, 0), text...)}
+	}
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write([]byte(text))
+	w.Close()
+	return pngChunk{kind: "iTXt", data: append(append(data, 1, 0, 0, 0), buf.Bytes()...)}
+}
+
+// sourceChunks returns the chunks recording the diagram's source and the
+// zml version in PNG output, so ExtractSource can get it back
+func (dia *Diagram) sourceChunks() []pngChunk {
+	if dia.source == "" {
+		return nil
+	}
+	return []pngChunk{
+		itxtChunk(softwareKeyword, "zml "+Version, false),
+		itxtChunk(hashKeyword, SourceHash([]byte(dia.source)), false),
+		itxtChunk(sourceKeyword, dia.source, true),
+	}
+}
+
+// SourceHash returns the hex SHA-256 of ZML source, as recorded in the PNG
+// images drawn from it
+func SourceHash(source []byte) string {
+	sum := sha256.Sum256(source)
+	return hex.EncodeToString(sum[:])
+}
+
+// EmbeddedHash returns the SourceHash recorded in a PNG written by zml
+func EmbeddedHash(r io.Reader) (string, error) {
+	texts, err := pngText(r)
+	if err != nil {
+		return "", err
+	}
+	hash, ok := texts[hashKeyword]
+	if !ok {
+		return "", errors.New("no ZML source hash in the image")
+	}
+	return hash, nil
+}
+
+// RenderedImages returns the PNG images drawn from the ZML file `source`
+// that exist: <source>.png, or its -light and -dark variants, and their
+// pages
+func RenderedImages(source string) []string {
+	var images []string
+	for _, base := range []string{source, source + "-light", source + "-dark"} {
+		if _, err := os.Stat(base + ".png"); err == nil {
+			images = append(images, base+".png")
+		}
+		for n := 1; ; n++ {
+			page := pageFile(base+".png", n)
+			if _, err := os.Stat(page); err != nil {
+				break
+			}
+			images = append(images, page)
+		}
+	}
+	return images
+}
+
+// pngText returns the text chunks, tEXt, zTXt and iTXt, of the PNG read
+// from `r` by keyword
+func pngText(r io.Reader) (map[string]string, error) {
+	signature := make([]byte, len(pngSignature))
+	if _, err := io.ReadFull(r, signature); err != nil || !bytes.Equal(signature, pngSignature) {
+		return nil, errors.New("not a PNG file")
+	}
+	texts := map[string]string{}
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil, fmt.Errorf("truncated PNG file: %s", err.Error())
+		}
+		length, kind := binary.BigEndian.Uint32(header[:4]), string(header[4:])
+		if kind == "IEND" {
+			return texts, nil
+		}
+		if kind != "tEXt" && kind != "zTXt" && kind != "iTXt" {
+			// skip the data and CRC
+			if _, err := io.CopyN(io.Discard, r, int64(length)+4); err != nil {
+				return nil, fmt.Errorf("truncated PNG file: %s", err.Error())
+			}
+			continue
+		}
+		data := make([]byte, length+4)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("truncated PNG file: %s", err.Error())
+		}
+		keyword, text, found := bytes.Cut(data[:length], []byte{0})
+		if !found {
+			continue
+		}
+		compressed := false
+		switch kind {
+		case "zTXt":
+			// always compressed, the method precedes the text
+			if len(text) < 1 {
+				continue
+			}
+			compressed, text = true, text[1:]
+		case "iTXt":
+			if len(text) < 2 {
+				continue
+			}
+			compressed, text = text[0] == 1, text[2:]
+			// skip the language tag and translated keyword
+			for i := 0; i < 2; i++ {
+				if _, text, found = bytes.Cut(text, []byte{0}); !found {
+					break
+				}
+			}
+			if !found {
+				continue
+			}
+		}
+		if compressed {
+			zr, err := zlib.NewReader(bytes.NewReader(text))
+			if err != nil {
+				return nil, fmt.Errorf("%s chunk \"%s\": %s", kind, keyword, err.Error())
+			}
+			if text, err = io.ReadAll(zr); err != nil {
+				return nil, fmt.Errorf("%s chunk \"%s\": %s", kind, keyword, err.Error())
+			}
+		}
+		texts[string(keyword)] = string(text)
+	}
+}
+
+// ExtractSource returns the ZML source stored in a PNG written by zml, and
+// the version of zml that wrote it
+func ExtractSource(r io.Reader) (string, string, error) {
+	texts, err := pngText(r)
+	if err != nil {
+		return "", "", err
+	}
+	source, ok := texts[sourceKeyword]
+	if !ok {
+		return "", "", errors.New("no ZML source in the image")
+	}
+	return source, strings.TrimPrefix(texts[softwareKeyword], "zml "), nil
+}
@@ -0,0 +1,71 @@
+package zml
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExtractSource(t *testing.T) {
+	source := "title: Café ☕\nAlice->>Bob: **hello**\n# a comment\nBob-->>Alice: 日本\n"
+	base := filepath.Join(t.TempDir(), "cafe.zml")
+	dia := NewDiagram(base)
+	dia.ProcessData([]byte(source))
+	dia.Render(400, 300, "")
+	data, err := os.ReadFile(base + ".png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the chunks keep the image valid
+	if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+		t.Fatalf("the image doesn't decode: %v", err)
+	}
+
+	got, version, err := ExtractSource(bytes.NewReader(data))
+	if err != nil || got != source || version != Version {
+		t.Errorf("ExtractSource = %q, %q, %v, want %q, %q", got, version, err, source, Version)
+	}
+	if hash, err := EmbeddedHash(bytes.NewReader(data)); err != nil || hash != SourceHash([]byte(source)) {
+		t.Errorf("EmbeddedHash = %q, %v, want %q", hash, err, SourceHash([]byte(source)))
+	}
+
+	var plain bytes.Buffer
+	png.Encode(&plain, image.NewGray(image.Rect(0, 0, 2, 2)))
+	for what, in := range map[string][]byte{
+		"a PNG without source": plain.Bytes(),
+		"a JPEG":               []byte("\xff\xd8\xff\xe0 not a png"),
+		"a truncated PNG":      data[:len(data)/2],
+	} {
+		if _, _, err := ExtractSource(bytes.NewReader(in)); err == nil {
+			t.Errorf("ExtractSource of %s returned no error", what)
+		}
+		if _, err := EmbeddedHash(bytes.NewReader(in)); err == nil {
+			t.Errorf("EmbeddedHash of %s returned no error", what)
+		}
+	}
+}
+
+func TestRenderedImages(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "flow.zml")
+	for _, name := range []string{"flow.zml-light.png", "flow.zml-dark-1.png", "flow.zml-dark-2.png", "flow.zml-dark-4.png", "other.zml.png"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{
+		filepath.Join(dir, "flow.zml-light.png"),
+		filepath.Join(dir, "flow.zml-dark-1.png"),
+		filepath.Join(dir, "flow.zml-dark-2.png"),
+	}
+	if got := RenderedImages(source); !reflect.DeepEqual(got, want) {
+		t.Errorf("RenderedImages = %v, want %v", got, want)
+	}
+	if got := RenderedImages(filepath.Join(dir, "none.zml")); got != nil {
+		t.Errorf("RenderedImages of a file never rendered = %v", got)
+	}
+}
@@ -0,0 +1,93 @@
+package zml
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// pageSizes are portrait page sizes in points
+var pageSizes = map[string][2]float64{
+	"a3":      {842, 1191},
+	"a4":      {595, 842},
+	"a5":      {420, 595},
+	"letter":  {612, 792},
+	"legal":   {612, 1008},
+	"tabloid": {792, 1224},
+}
+
+// sequencePage is the part of a sequence diagram drawn on one page: the
+// messages from `first` up to `last`, excluded, below participant boxes at
+// `top`. rows holds the y of each message followed by the end of the
+// lifelines.
+type sequencePage struct {
+	first, last int
+	top         float64
+	rows        []float64
+}
+
+// ParsePageSize reads a page size: a name, e.g. "A4" or "Letter", with an
+// optional ":landscape", or "<width>x<height>" in points, e.g. "800x600"
+func ParsePageSize(s string) (float64, float64, error) {
+	name, orientation, _ := strings.Cut(strings.ToLower(strings.TrimSpace(s)), ":")
+	size, ok := pageSizes[name]
+	if !ok {
+		w, h, found := strings.Cut(name, "x")
+		width, errW := strconv.ParseFloat(w, 64)
+		height, errH := strconv.ParseFloat(h, 64)
+		if !found || errW != nil || errH != nil || width <= 0 || height <= 0 {
+			return 0, 0, fmt.Errorf("unknown page size \"%s\"", s)
+		}
+		size = [2]float64{width, height}
+	}
+	switch orientation {
+	case "", "portrait":
+	case "landscape":
+		size[0], size[1] = size[1], size[0]
+	default:
+		return 0, 0, fmt.Errorf("unknown page orientation \"%s\"", orientation)
+	}
+	return size[0], size[1], nil
+}
+
+// SetPageSize splits sequence diagrams into pages of `width` by `height`
+// points, which are pixels in PNG output; 0 draws them on a single page as
+// tall as they need. Other kinds of diagrams always take a single page.
+func (dia *Diagram) SetPageSize(width, height float64) {
+	dia.pageWidth, dia.pageHeight = width, height
+	if dia.debug {
+		log.Printf("pageSize: %gx%g", width, height)
+	}
+}
+
+// paginated reports whether the diagram is split into pages
+func (dia *Diagram) paginated() bool {
+	return dia.kind == SEQUENCE && dia.pageWidth > 0 && dia.pageHeight > 0
+}
+
+// pageFile returns the name of page `n` of `filename`, e.g. diagram-2.png
+// for diagram.png
+func pageFile(filename string, n int) string {
+	ext := ""
+	if dot := strings.LastIndexByte(filename, '.'); dot >= 0 {
+		filename, ext = filename[:dot], filename[dot:]
+	}
+	return fmt.Sprintf("%s-%d%s", filename, n, ext)
+}
+
+// renderContinuation notes on a page of a sequence diagram which pages it
+// continues from and on
+func (dia *Diagram) renderContinuation(n int) {
+	page := dia.pages[n]
+	font := dia.themedLabelFont()
+	dia.useFont(font)
+	dia.setColor(dia.readableText(font.Color, dia.bgColor))
+	centerX := float64(dia.dc.Width()) / 2
+	if n > 0 {
+		dia.drawText(fmt.Sprintf("*continued from page %d*", n), centerX, height*0.05, 0.5, 0)
+	}
+	if n < len(dia.pages)-1 {
+		dia.drawText(fmt.Sprintf("*continued on page %d*", n+2), centerX, page.rows[len(page.rows)-1]+1+dia.headerHeight/2, 0.5, 0.35)
+	}
+}
@@ -0,0 +1,113 @@
+package zml
+
+import (
+	"bytes"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParsePageSize(t *testing.T) {
+	tests := []struct {
+		in            string
+		width, height float64
+		wantErr       bool
+	}{
+		{"A4", 595, 842, false},
+		{" letter ", 612, 792, false},
+		{"a3:landscape", 1191, 842, false},
+		{"Legal:Portrait", 612, 1008, false},
+		{"800x600", 800, 600, false},
+		{"800x600:landscape", 600, 800, false},
+		{"612.5x792", 612.5, 792, false},
+		{"B5", 0, 0, true},
+		{"800", 0, 0, true},
+		{"0x600", 0, 0, true},
+		{"800x-1", 0, 0, true},
+		{"A4:sideways", 0, 0, true},
+	}
+	for _, tt := range tests {
+		width, height, err := ParsePageSize(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParsePageSize(%q): error %v, want error %t", tt.in, err, tt.wantErr)
+			continue
+		}
+		if width != tt.width || height != tt.height {
+			t.Errorf("ParsePageSize(%q) = %g, %g, want %g, %g", tt.in, width, height, tt.width, tt.height)
+		}
+	}
+}
+
+func TestPageFile(t *testing.T) {
+	for in, want := range map[string]string{
+		"diagram.zml.png": "diagram.zml-2.png",
+		"out/flow.pdf":    "out/flow-2.pdf",
+		"noext":           "noext-2",
+	} {
+		if got := pageFile(in, 2); got != want {
+			t.Errorf("pageFile(%q, 2) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "long.zml")
+	dia := NewDiagram(base)
+	dia.SetPageSize(595, 842)
+	dia.ProcessData(longSequence(60))
+	dia.Render(595, 842, "")
+
+	if len(dia.pages) < 2 {
+		t.Fatalf("60 messages took %d page(s) of A4", len(dia.pages))
+	}
+	next := 0
+	for n, page := range dia.pages {
+		if page.first != next || page.last <= page.first {
+			t.Errorf("page %d has messages %d to %d, want them to start at %d", n+1, page.first, page.last, next)
+		}
+		next = page.last
+		// closing boxes fit below the last row
+		if end := page.rows[len(page.rows)-1] + 1 + dia.headerHeight + elemenetsPadding; end > 842 {
+			t.Errorf("page %d ends at %g, below the page", n+1, end)
+		}
+	}
+	if next != len(dia.edges) {
+		t.Errorf("pages end at message %d of %d", next, len(dia.edges))
+	}
+	for n := 1; n <= len(dia.pages); n++ {
+		f, err := os.Open(pageFile(base+".png", n))
+		if err != nil {
+			t.Fatal(err)
+		}
+		config, err := png.DecodeConfig(f)
+		f.Close()
+		if err != nil || config.Width != 595 || config.Height != 842 {
+			t.Errorf("page %d is %dx%d, %v, want 595x842", n, config.Width, config.Height, err)
+		}
+	}
+	if _, err := os.Stat(pageFile(base+".png", len(dia.pages)+1)); err == nil {
+		t.Errorf("a page beyond the last was written")
+	}
+
+	// PDF output puts the pages in one file
+	if err := dia.SetFormat(PDF); err != nil {
+		t.Fatal(err)
+	}
+	dia.Render(595, 842, "")
+	data, err := os.ReadFile(base + ".pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(data, []byte("/Type /Page\n")); n != len(dia.pages) {
+		t.Errorf("the PDF has %d pages, want %d", n, len(dia.pages))
+	}
+
+	// other kinds of diagrams aren't split
+	dia = NewDiagram(filepath.Join(t.TempDir(), "tree.zml"))
+	dia.SetPageSize(100, 100)
+	dia.SetKind(TREE)
+	if dia.paginated() {
+		t.Errorf("a tree is paginated")
+	}
+}
@@ -0,0 +1,318 @@
+package zml
+
+import (
+	"fmt"
+	"image/color"
+	"log"
+	"math"
+
+	"github.com/fogleman/gg"
+	"github.com/jung-kurt/gofpdf"
+	"golang.org/x/image/font"
+)
+
+// pdfCanvas draws a diagram as a PDF, one point per pixel, on a single page
+// or on one page per page of a paginated sequence diagram.
+// Shapes are kept as paths and text as text, in the diagram's fonts which
+// are embedded with only the glyphs used. Text is measured by a gg.Context
+// so it lays out exactly as in PNG output.
+type pdfCanvas struct {
+	pdf      *gofpdf.Fpdf
+	measure  *gg.Context
+	width    float64
+	height   float64
+	face     font.Face
+	path     []pathOp
+	evenOdd  bool
+	families map[string]string
+}
+
+// pathOp is a step of the current path: a move, a line, a cubic curve
+// through two control points or a close
+type pathOp struct {
+	kind   byte
+	points [3]point
+}
+
+// kappa places the control points of a cubic curve drawing a quarter circle
+var kappa = 4 * (math.Sqrt2 - 1) / 3
+
+func newPDFCanvas(width, height float64, title, author string) *pdfCanvas {
+	pdf := gofpdf.NewCustom(&gofpdf.InitType{
+		UnitStr: "pt",
+		Size:    gofpdf.SizeType{Wd: width, Ht: height},
+	})
+	pdf.SetMargins(0, 0, 0)
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.SetTitle(title, true)
+	if author != "" {
+		pdf.SetAuthor(author, true)
+	}
+	pdf.SetCreator("zml", true)
+	pdf.AddPage()
+	// gg's defaults
+	pdf.SetLineCapStyle("round")
+	pdf.SetLineJoinStyle("round")
+	return &pdfCanvas{
+		pdf:      pdf,
+		measure:  gg.NewContext(1, 1),
+		width:    width,
+		height:   height,
+		families: map[string]string{},
+	}
+}
+
+func (c *pdfCanvas) Width() int {
+	return int(c.width)
+}
+
+func (c *pdfCanvas) Height() int {
+	return int(c.height)
+}
+
+func (c *pdfCanvas) SetColor(col color.Color) {
+	rgba := color.NRGBAModel.Convert(col).(color.NRGBA)
+	r, g, b := int(rgba.R), int(rgba.G), int(rgba.B)
+	c.pdf.SetDrawColor(r, g, b)
+	c.pdf.SetFillColor(r, g, b)
+	c.pdf.SetTextColor(r, g, b)
+	c.pdf.SetAlpha(float64(rgba.A)/255, "Normal")
+}
+
+func (c *pdfCanvas) SetLineWidth(lineWidth float64) {
+	c.pdf.SetLineWidth(lineWidth)
+}
+
+func (c *pdfCanvas) SetDash(dashes ...float64) {
+	c.pdf.SetDashPattern(dashes, 0)
+}
+
+func (c *pdfCanvas) SetFillRule(fillRule gg.FillRule) {
+	c.evenOdd = fillRule == gg.FillRuleEvenOdd
+}
+
+// current returns the last point of the path, if any
+func (c *pdfCanvas) current() (point, bool) {
+	if len(c.path) == 0 {
+		return point{}, false
+	}
+	last := c.path[len(c.path)-1]
+	switch last.kind {
+	case 'M', 'L':
+		return last.points[0], true
+	case 'C':
+		return last.points[2], true
+	}
+	// a closed subpath ends where it started
+	for i := len(c.path) - 1; i >= 0; i-- {
+		if c.path[i].kind == 'M' {
+			return c.path[i].points[0], true
+		}
+	}
+	return point{}, false
+}
+
+func (c *pdfCanvas) MoveTo(x, y float64) {
+	c.path = append(c.path, pathOp{kind: 'M', points: [3]point{{x, y}}})
+}
+
+func (c *pdfCanvas) LineTo(x, y float64) {
+	if _, ok := c.current(); !ok {
+		c.MoveTo(x, y)
+		return
+	}
+	c.path = append(c.path, pathOp{kind: 'L', points: [3]point{{x, y}}})
+}
+
+func (c *pdfCanvas) QuadraticTo(x1, y1, x2, y2 float64) {
+	p0, ok := c.current()
+	if !ok {
+		c.MoveTo(x1, y1)
+		p0 = point{x1, y1}
+	}
+	// the same curve with cubic control points
+	c.path = append(c.path, pathOp{kind: 'C', points: [3]point{
+		{p0.X + 2*(x1-p0.X)/3, p0.Y + 2*(y1-p0.Y)/3},
+		{x2 + 2*(x1-x2)/3, y2 + 2*(y1-y2)/3},
+		{x2, y2},
+	}})
+}
+
+func (c *pdfCanvas) closePath() {
+	c.path = append(c.path, pathOp{kind: 'Z'})
+}
+
+// arc adds a quarter circle around (cx, cy) from angle a0, going clockwise
+// on the page like gg's DrawArc
+func (c *pdfCanvas) arc(cx, cy, r, a0 float64) {
+	a1 := a0 + math.Pi/2
+	x0, y0 := cx+r*math.Cos(a0), cy+r*math.Sin(a0)
+	x1, y1 := cx+r*math.Cos(a1), cy+r*math.Sin(a1)
+	if p, ok := c.current(); !ok {
+		c.MoveTo(x0, y0)
+	} else if math.Abs(p.X-x0) > 1e-9 || math.Abs(p.Y-y0) > 1e-9 {
+		c.LineTo(x0, y0)
+	}
+	c.path = append(c.path, pathOp{kind: 'C', points: [3]point{
+		{x0 - kappa*r*math.Sin(a0), y0 + kappa*r*math.Cos(a0)},
+		{x1 + kappa*r*math.Sin(a1), y1 - kappa*r*math.Cos(a1)},
+		{x1, y1},
+	}})
+}
+
+func (c *pdfCanvas) DrawLine(x1, y1, x2, y2 float64) {
+	c.MoveTo(x1, y1)
+	c.LineTo(x2, y2)
+}
+
+func (c *pdfCanvas) DrawRectangle(x, y, w, h float64) {
+	c.MoveTo(x, y)
+	c.LineTo(x+w, y)
+	c.LineTo(x+w, y+h)
+	c.LineTo(x, y+h)
+	c.closePath()
+}
+
+func (c *pdfCanvas) DrawRoundedRectangle(x, y, w, h, r float64) {
+	c.MoveTo(x+r, y)
+	c.LineTo(x+w-r, y)
+	c.arc(x+w-r, y+r, r, -math.Pi/2)
+	c.LineTo(x+w, y+h-r)
+	c.arc(x+w-r, y+h-r, r, 0)
+	c.LineTo(x+r, y+h)
+	c.arc(x+r, y+h-r, r, math.Pi/2)
+	c.LineTo(x, y+r)
+	c.arc(x+r, y+r, r, math.Pi)
+	c.closePath()
+}
+
+func (c *pdfCanvas) DrawCircle(x, y, r float64) {
+	c.MoveTo(x+r, y)
+	for a := 0.0; a < 2*math.Pi; a += math.Pi / 2 {
+		c.arc(x, y, r, a)
+	}
+	c.closePath()
+}
+
+// paint replays the path and strokes or fills it with `style`, see
+// gofpdf's DrawPath
+func (c *pdfCanvas) paint(style string) {
+	for _, op := range c.path {
+		p := op.points
+		switch op.kind {
+		case 'M':
+			c.pdf.MoveTo(p[0].X, p[0].Y)
+		case 'L':
+			c.pdf.LineTo(p[0].X, p[0].Y)
+		case 'C':
+			c.pdf.CurveBezierCubicTo(p[0].X, p[0].Y, p[1].X, p[1].Y, p[2].X, p[2].Y)
+		case 'Z':
+			c.pdf.ClosePath()
+		}
+	}
+	if len(c.path) > 0 {
+		c.pdf.DrawPath(style)
+	}
+}
+
+func (c *pdfCanvas) Stroke() {
+	c.paint("D")
+	c.path = nil
+}
+
+func (c *pdfCanvas) FillPreserve() {
+	if c.evenOdd {
+		c.paint("F*")
+	} else {
+		c.paint("F")
+	}
+}
+
+func (c *pdfCanvas) Fill() {
+	c.FillPreserve()
+	c.path = nil
+}
+
+func (c *pdfCanvas) SetFontFace(fontFace font.Face) {
+	c.face = fontFace
+	c.measure.SetFontFace(fontFace)
+}
+
+func (c *pdfCanvas) MeasureString(s string) (float64, float64) {
+	return c.measure.MeasureString(s)
+}
+
+// family returns the PDF font family of `face`, embedding its font the
+// first time, or "" when the font can't be embedded
+func (c *pdfCanvas) family(face *sharedFace) string {
+	family, ok := c.families[face.source]
+	if !ok {
+		family = fmt.Sprintf("F%d", len(c.families)+1)
+		c.pdf.AddUTF8FontFromBytes(family, "", face.data)
+		if c.pdf.GetFontDesc(family, "").Ascent == 0 {
+			log.Printf("%s can't be embedded in a PDF, using Helvetica", face.source)
+			family = ""
+		}
+		c.families[face.source] = family
+	}
+	return family
+}
+
+// DrawString draws `s` with its baseline starting at (x, y), setting the
+// runs a fallback face draws with other fonts in those fonts
+func (c *pdfCanvas) DrawString(s string, x, y float64) {
+	var chain *fallbackFace
+	switch face := c.face.(type) {
+	case *sharedFace:
+		chain = &fallbackFace{faces: []*sharedFace{face}}
+	case *fallbackFace:
+		chain = face
+	default:
+		log.Printf("can't draw \"%s\" with a %T in a PDF", s, c.face)
+		return
+	}
+
+	draw := func(text string, face *sharedFace) {
+		advance := float64(font.MeasureString(face, text)) / 64
+		if family := c.family(face); family != "" {
+			c.pdf.SetFont(family, "", face.size)
+		} else {
+			c.pdf.SetFont("Helvetica", "", face.size)
+			text = c.pdf.UnicodeTranslatorFromDescriptor("")(text)
+		}
+		c.pdf.Text(x, y, text)
+		x += advance
+	}
+	start := 0
+	var runFace *sharedFace
+	for i, r := range s {
+		if face := chain.pick(r); face != runFace {
+			if runFace != nil {
+				draw(s[start:i], runFace)
+			}
+			runFace, start = face, i
+		}
+	}
+	if runFace != nil {
+		draw(s[start:], runFace)
+	}
+}
+
+func (c *pdfCanvas) DrawStringAnchored(s string, x, y, ax, ay float64) {
+	w, h := c.MeasureString(s)
+	c.DrawString(s, x-ax*w, y+ay*h)
+}
+
+func (c *pdfCanvas) link(x, y, w, h float64, url string) {
+	c.pdf.LinkString(x, y, w, h, url)
+}
+
+// addPage starts a new page of the same size, discarding any unpainted path
+func (c *pdfCanvas) addPage() {
+	c.pdf.AddPage()
+	c.path = nil
+}
+
+func (c *pdfCanvas) save(filename string) error {
+	return c.pdf.OutputFileAndClose(filename)
+}
@@ -0,0 +1,62 @@
+package zml
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+)
+
+// pdfString returns `s` as gofpdf writes UTF-8 document properties: UTF-16
+// with a byte order mark
+func pdfString(s string) []byte {
+	out := []byte{0xfe, 0xff}
+	for _, u := range utf16.Encode([]rune(s)) {
+		out = append(out, byte(u>>8), byte(u))
+	}
+	return out
+}
+
+func renderPDF(t *testing.T, source, author string) []byte {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "diagram.zml")
+	dia := NewDiagram(filename)
+	if err := dia.SetFormat(PDF); err != nil {
+		t.Fatal(err)
+	}
+	dia.SetAuthor(author)
+	dia.ProcessData([]byte(source))
+	dia.Render(600, 400, "")
+	data, err := os.ReadFile(filename + ".pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestRenderPDF(t *testing.T) {
+	data := renderPDF(t, "title: Payments **flow**\nA->>B: see [the docs](https://example.com/docs)", "Jane Doe")
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		t.Fatalf("not a PDF: %q", data[:16])
+	}
+	for what, want := range map[string][]byte{
+		"one page":           []byte("/MediaBox [0 0 600.00 400.00]"),
+		"an embedded font":   []byte("/FontFile2"),
+		"the link":           []byte("/URI (https://example.com/docs)"),
+		"the plain title":    append([]byte("/Title ("), pdfString("Payments flow")...),
+		"the author":         append([]byte("/Author ("), pdfString("Jane Doe")...),
+		"zml as the creator": append([]byte("/Creator ("), pdfString("zml")...),
+	} {
+		if !bytes.Contains(data, want) {
+			t.Errorf("the PDF lacks %s, %q", what, want)
+		}
+	}
+	if n := bytes.Count(data, []byte("/Type /Page\n")); n != 1 {
+		t.Errorf("the PDF has %d pages, want 1", n)
+	}
+
+	if data := renderPDF(t, "A->>B: hi", ""); bytes.Contains(data, []byte("/Author")) {
+		t.Errorf("a PDF with no author given has an /Author")
+	}
+}
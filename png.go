@@ -0,0 +1,54 @@
+package zml
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+	"math"
+)
+
+// pngHeaderSize is the length of a PNG's signature and IHDR chunk, which
+// other chunks must follow
+const pngHeaderSize = 8 + 4 + 4 + 13 + 4
+
+// pngChunk is an ancillary chunk added to PNG output
+type pngChunk struct {
+	kind string
+	data []byte
+}
+
+// bytes returns the chunk as stored: length, type, data and CRC
+func (c pngChunk) bytes() []byte {
+	out := make([]byte, 0, 12+len(c.data))
+	out = binary.BigEndian.AppendUint32(out, uint32(len(c.data)))
+	out = append(out, c.kind...)
+	out = append(out, c.data...)
+	return binary.BigEndian.AppendUint32(out, crc32.ChecksumIEEE(out[4:]))
+}
+
+// physChunk records the resolution of an image, `dpi` pixels per inch
+func physChunk(dpi float64) pngChunk {
+	perMeter := uint32(math.Round(dpi / 0.0254))
+	data := binary.BigEndian.AppendUint32(nil, perMeter)
+	data = binary.BigEndian.AppendUint32(data, perMeter)
+	// the unit is the meter
+	return pngChunk{kind: "pHYs", data: append(data, 1)}
+}
+
+// writePNG encodes `img` to `w` with `chunks` after its header
+func writePNG(w io.Writer, img image.Image, chunks ...pngChunk) error {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return err
+	}
+	encoded := buf.Bytes()
+	out := append([]byte{}, encoded[:pngHeaderSize]...)
+	for _, chunk := range chunks {
+		out = append(out, chunk.bytes()...)
+	}
+	_, err := w.Write(append(out, encoded[pngHeaderSize:]...))
+	return err
+}
@@ -0,0 +1,195 @@
+package zml
+
+import (
+	"regexp"
+	"strings"
+)
+
+// codeFontFamily draws `code` spans
+const codeFontFamily = "Go Mono"
+
+// textRun is a stretch of label text drawn with one face
+type textRun struct {
+	text   string
+	bold   bool
+	italic bool
+	code   bool
+	url    string
+}
+
+var richLinkRegexp = regexp.MustCompile(`^\[([^\]]*)\]\(([^)\s]*)\)`)
+
+// parseRichText splits a label into runs following a small subset of
+// Markdown: **bold**, *italic*, `code` and [text](url). Markers without a
+// closing counterpart are kept as text, as is anything escaped with `\`.
+func parseRichText(s string) []textRun {
+	var runs []textRun
+	var current textRun
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			run := current
+			run.text = text.String()
+			runs = append(runs, run)
+			text.Reset()
+		}
+	}
+
+	for i := 0; i < len(s); {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && strings.IndexByte("\\*`[]", s[i+1]) >= 0:
+			text.WriteByte(s[i+1])
+			i += 2
+		case s[i] == '`' && strings.IndexByte(s[i+1:], '`') > 0:
+			flush()
+			end := strings.IndexByte(s[i+1:], '`')
+			code := current
+			code.text, code.code = s[i+1:i+1+end], true
+			runs = append(runs, code)
+			i += end + 2
+		case strings.HasPrefix(s[i:], "**") && (current.bold || opensEmphasis(s[i+2:], "**")):
+			flush()
+			current.bold = !current.bold
+			i += 2
+		case s[i] == '*' && !strings.HasPrefix(s[i:], "**") && (current.italic || opensEmphasis(s[i+1:], "*")):
+			flush()
+			current.italic = !current.italic
+			i++
+		case s[i] == '[' && richLinkRegexp.MatchString(s[i:]):
+			flush()
+			parts := richLinkRegexp.FindStringSubmatch(s[i:])
+			link := current
+			link.text, link.url = parts[1], parts[2]
+			runs = append(runs, link)
+			i += len(parts[0])
+		default:
+			text.WriteByte(s[i])
+			i++
+		}
+	}
+	flush()
+	return runs
+}
+
+// opensEmphasis reports whether a `marker` followed by `rest` starts an
+// emphasis: like Markdown, it must touch the text it emphasises and be
+// closed later by an unescaped marker that touches it too, so "2 * 3" stays
+// as it is
+func opensEmphasis(rest, marker string) bool {
+	if rest == "" || rest[0] == ' ' {
+		return false
+	}
+	for i := 1; i < len(rest); i++ {
+		switch {
+		case rest[i] == '\\':
+			i++
+		case strings.HasPrefix(rest[i:], marker) && rest[i-1] != ' ':
+			return true
+		}
+	}
+	return false
+}
+
+// isPlain reports whether `runs` need nothing but the current font
+func isPlain(runs []textRun) bool {
+	return len(runs) == 0 || len(runs) == 1 && runs[0] == textRun{text: runs[0].text}
+}
+
+// plainText returns the text of `runs` without their markup
+func plainText(runs []textRun) string {
+	var text strings.Builder
+	for _, run := range runs {
+		text.WriteString(run.text)
+	}
+	return text.String()
+}
+
+// emboldened returns a copy of `runs` all drawn bold
+func emboldened(runs []textRun) []textRun {
+	bold := make([]textRun, len(runs))
+	for i, run := range runs {
+		run.bold = true
+		bold[i] = run
+	}
+	return bold
+}
+
+// runFont returns the font to draw `run` with when the label's font is `base`
+func runFont(base Font, run textRun) Font {
+	f := base
+	if run.code {
+		f.Name = codeFontFamily
+		if base.Name != "" {
+			f.Fallback = append([]string{base.Name}, base.Fallback...)
+		}
+	}
+	switch {
+	case run.bold && run.italic:
+		f.Style = "bold italic"
+	case run.bold:
+		f.Style = "bold"
+	case run.italic:
+		f.Style = "italic"
+	}
+	return f
+}
+
+// measureRuns returns the width of `runs` drawn one after the other and the
+// height of the current font
+func (dia *Diagram) measureRuns(runs []textRun) (float64, float64) {
+	if isPlain(runs) {
+		return dia.dc.MeasureString(plainText(runs))
+	}
+	base := dia.currentFont
+	width := 0.0
+	for _, run := range runs {
+		dia.useFont(runFont(base, run))
+		w, _ := dia.dc.MeasureString(run.text)
+		width += w
+	}
+	dia.useFont(base)
+	_, h := dia.dc.MeasureString("")
+	return width, h
+}
+
+// drawRuns draws `runs` with their faces, anchored like DrawStringAnchored:
+// (ax, ay) is the point of the text's box placed at (x, y), from (0, 0) for
+// the start of the baseline to (1, 1) for the end of the top line. Links are
+// underlined, and clickable in PDF output.
+func (dia *Diagram) drawRuns(runs []textRun, x, y, ax, ay float64) {
+	if isPlain(runs) {
+		dia.dc.DrawStringAnchored(plainText(runs), x, y, ax, ay)
+		return
+	}
+	base := dia.currentFont
+	defer dia.useFont(base)
+	w, h := dia.measureRuns(runs)
+	x -= ax * w
+	y += ay * h
+	for _, run := range runs {
+		dia.useFont(runFont(base, run))
+		runWidth, _ := dia.dc.MeasureString(run.text)
+		dia.dc.DrawString(run.text, x, y)
+		if run.url != "" {
+			dia.dc.SetLineWidth(lineStrokeWidth)
+			dia.dc.DrawLine(x, y+2, x+runWidth, y+2)
+			dia.dc.Stroke()
+			if l, ok := dia.dc.(linker); ok {
+				l.link(x, y-h, runWidth, h+2, run.url)
+			}
+		}
+		x += runWidth
+	}
+}
+
+// measureText measures a label that may hold rich text markup and line
+// breaks, wrapped to the maximum label width
+func (dia *Diagram) measureText(s string) (float64, float64) {
+	return dia.measureLines(dia.wrapLines(labelLines(s), dia.labelWidth(0)))
+}
+
+// drawText draws a label that may hold rich text markup and line breaks,
+// wrapped to the maximum label width, see drawLines
+func (dia *Diagram) drawText(s string, x, y, ax, ay float64) {
+	dia.drawLines(dia.wrapLines(labelLines(s), dia.labelWidth(0)), x, y, ax, ay)
+}
@@ -0,0 +1,76 @@
+package zml
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRichText(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []textRun
+	}{
+		{"", nil},
+		{"plain", []textRun{{text: "plain"}}},
+		{"a **bold** b", []textRun{{text: "a "}, {text: "bold", bold: true}, {text: " b"}}},
+		{"*it* and `x := 1`", []textRun{{text: "it", italic: true}, {text: " and "}, {text: "x := 1", code: true}}},
+		{"***both***", []textRun{{text: "both", bold: true, italic: true}}},
+		{"**bold *and italic***", []textRun{{text: "bold ", bold: true}, {text: "and italic", bold: true, italic: true}}},
+		{"see [the docs](https://example.com/a_b)", []textRun{{text: "see "}, {text: "the docs", url: "https://example.com/a_b"}}},
+		{"**[bold link](u)**", []textRun{{text: "bold link", bold: true, url: "u"}}},
+		// markers that don't open or aren't closed stay as text
+		{"2 * 3 * 4", []textRun{{text: "2 * 3 * 4"}}},
+		{"**unclosed", []textRun{{text: "**unclosed"}}},
+		{"a `tick", []textRun{{text: "a `tick"}}},
+		{"[no url] here", []textRun{{text: "[no url] here"}}},
+		{`\*literal\* \[x\](y) \\`, []textRun{{text: `*literal* [x](y) \`}}},
+	}
+	for _, tt := range tests {
+		if got := parseRichText(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseRichText(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRunFont(t *testing.T) {
+	base := Font{Name: "Noto Sans", Fallback: []string{"Noto Emoji"}, Size: 14}
+	tests := []struct {
+		run  textRun
+		want Font
+	}{
+		{textRun{}, base},
+		{textRun{bold: true}, Font{Name: "Noto Sans", Style: "bold", Fallback: []string{"Noto Emoji"}, Size: 14}},
+		{textRun{bold: true, italic: true}, Font{Name: "Noto Sans", Style: "bold italic", Fallback: []string{"Noto Emoji"}, Size: 14}},
+		// code falls back to the label's font for runes Go Mono lacks
+		{textRun{code: true, italic: true}, Font{Name: codeFontFamily, Style: "italic", Fallback: []string{"Noto Sans", "Noto Emoji"}, Size: 14}},
+	}
+	for _, tt := range tests {
+		if got := runFont(base, tt.run); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("runFont(%+v) = %+v, want %+v", tt.run, got, tt.want)
+		}
+	}
+	if got := runFont(Font{Size: 9}, textRun{code: true}); got.Name != codeFontFamily || got.Fallback != nil {
+		t.Errorf("code in the default font = %+v", got)
+	}
+	if base.Fallback[0] != "Noto Emoji" || len(base.Fallback) != 1 {
+		t.Errorf("runFont changed the base font's fallbacks to %v", base.Fallback)
+	}
+}
+
+func TestMeasureRichText(t *testing.T) {
+	dia := NewDiagram("test")
+	dia.dc = newRasterCanvas(100, 100, 1)
+	dia.useFont(Font{Size: 14})
+	plain, h := dia.measureText("Hello world")
+	rich, richH := dia.measureText("Hello **world**")
+	if plain <= 0 || h <= 0 || richH != h {
+		t.Fatalf("measured %gx%g and %gx%g", plain, h, rich, richH)
+	}
+	// bold is wider than regular, but the markers take no room
+	if rich <= plain || rich > plain*1.2 {
+		t.Errorf("\"Hello **world**\" is %g wide, \"Hello world\" %g", rich, plain)
+	}
+	if w, _ := dia.measureText("[Hello world](https://example.com)"); w != plain {
+		t.Errorf("a link is %g wide, its text %g", w, plain)
+	}
+}
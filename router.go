@@ -0,0 +1,575 @@
+package zml
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+)
+
+const (
+	// ORTHOGONAL routes links as horizontal and vertical segments around nodes
+	ORTHOGONAL = "orthogonal"
+	// SPLINE routes links like ORTHOGONAL, with the corners smoothed into curves
+	SPLINE = "spline"
+	// STRAIGHT draws links as straight lines between node borders
+	STRAIGHT = "straight"
+
+	routeMargin     = 12.0
+	bendPenalty     = 40.0
+	crowdingPenalty = 25.0
+	// crossingPenalty is charged per grid segment on or across the border of
+	// a group holding neither end of the link, enough to go around it
+	crossingPenalty = 1000.0
+	edgeSeparation  = 8.0
+	cornerRadius    = 12.0
+)
+
+type rect struct {
+	x0, y0, x1, y1 float64
+}
+
+func nodeRect(n *node) rect {
+	return rect{n.x, n.y, n.x + n.w, n.y + n.h}
+}
+
+func (r rect) contains(x, y float64) bool {
+	return x >= r.x0 && x <= r.x1 && y >= r.y0 && y <= r.y1
+}
+
+func (r rect) overlaps(o rect) bool {
+	return r.x0 < o.x1 && o.x0 < r.x1 && r.y0 < o.y1 && o.y0 < r.y1
+}
+
+// router finds orthogonal paths over a sparse grid built from the borders of
+// the nodes to avoid, inflated by routeMargin, and their centers
+type router struct {
+	xs, ys    []float64
+	obstacles []*node
+	// obstacles blocking each grid segment, indexed by segmentIndex
+	blockers map[int][]*node
+	// groups whose border each grid segment runs on or across
+	borders map[int][]*node
+	// number of routed links using each grid segment
+	used map[int]int
+}
+
+// leaves returns the nodes under `n` that aren't groups
+func leaves(n *node) []*node {
+	if !n.isGroup() {
+		return []*node{n}
+	}
+	var result []*node
+	for _, c := range n.children {
+		result = append(result, leaves(c)...)
+	}
+	return result
+}
+
+func uniqueSorted(values []float64) []float64 {
+	sort.Float64s(values)
+	result := values[:0]
+	for i, v := range values {
+		if i == 0 || v-result[len(result)-1] > 0.5 {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func newRouter(obstacles []*node, groups []*node) *router {
+	r := &router{
+		obstacles: obstacles,
+		blockers:  make(map[int][]*node),
+		borders:   make(map[int][]*node),
+		used:      make(map[int]int),
+	}
+	var xs, ys []float64
+	for _, n := range append(obstacles, groups...) {
+		xs = append(xs, n.x-routeMargin, n.x+n.w+routeMargin, n.x+n.w/2)
+		ys = append(ys, n.y-routeMargin, n.y+n.h+routeMargin, n.y+n.h/2)
+	}
+	xs, ys = uniqueSorted(xs), uniqueSorted(ys)
+	// channels half way between obstacles give links room to pass each other
+	for i := len(xs) - 1; i > 0; i-- {
+		xs = append(xs, (xs[i]+xs[i-1])/2)
+	}
+	for i := len(ys) - 1; i > 0; i-- {
+		ys = append(ys, (ys[i]+ys[i-1])/2)
+	}
+	if len(xs) > 0 {
+		xs = append(xs, xs[0]-routeMargin, xs[len(xs)-1]+routeMargin)
+	}
+	if len(ys) > 0 {
+		ys = append(ys, ys[0]-routeMargin, ys[len(ys)-1]+routeMargin)
+	}
+	r.xs, r.ys = uniqueSorted(xs), uniqueSorted(ys)
+
+	for _, n := range obstacles {
+		inflated := rect{n.x - routeMargin, n.y - routeMargin, n.x + n.w + routeMargin, n.y + n.h + routeMargin}
+		i0, i1 := r.column(inflated.x0), r.column(inflated.x1)
+		j0, j1 := r.row(inflated.y0), r.row(inflated.y1)
+		for j := j0; j <= j1 && j < len(r.ys); j++ {
+			for i := i0; i <= i1 && i < len(r.xs); i++ {
+				// a segment is blocked when its middle is strictly inside
+				if i+1 < len(r.xs) && i < i1 && j > j0 && j < j1 {
+					key := r.segmentIndex(i, j, true)
+					r.blockers[key] = append(r.blockers[key], n)
+				}
+				if j+1 < len(r.ys) && j < j1 && i > i0 && i < i1 {
+					key := r.segmentIndex(i, j, false)
+					r.blockers[key] = append(r.blockers[key], n)
+				}
+			}
+		}
+	}
+	for _, g := range groups {
+		r.markBorder(g)
+	}
+	return r
+}
+
+// markBorder records the grid segments running on or across the border of
+// the group `g`
+func (r *router) markBorder(g *node) {
+	b := nodeRect(g)
+	near := func(a, b float64) bool {
+		return math.Abs(a-b) < 0.5
+	}
+	// crosses reports whether [low, high] reaches over `edge`
+	crosses := func(low, high, edge float64) bool {
+		return low-0.5 <= edge && edge <= high+0.5
+	}
+	for j, y := range r.ys {
+		for i := 0; i+1 < len(r.xs); i++ {
+			x0, x1 := r.xs[i], r.xs[i+1]
+			if y < b.y0-0.5 || y > b.y1+0.5 || x1 < b.x0-0.5 || x0 > b.x1+0.5 {
+				continue
+			}
+			if near(y, b.y0) || near(y, b.y1) || crosses(x0, x1, b.x0) || crosses(x0, x1, b.x1) {
+				key := r.segmentIndex(i, j, true)
+				r.borders[key] = append(r.borders[key], g)
+			}
+		}
+	}
+	for i, x := range r.xs {
+		for j := 0; j+1 < len(r.ys); j++ {
+			y0, y1 := r.ys[j], r.ys[j+1]
+			if x < b.x0-0.5 || x > b.x1+0.5 || y1 < b.y0-0.5 || y0 > b.y1+0.5 {
+				continue
+			}
+			if near(x, b.x0) || near(x, b.x1) || crosses(y0, y1, b.y0) || crosses(y0, y1, b.y1) {
+				key := r.segmentIndex(i, j, false)
+				r.borders[key] = append(r.borders[key], g)
+			}
+		}
+	}
+}
+
+// column returns the index of the grid line at `x`
+func (r *router) column(x float64) int {
+	return sort.SearchFloat64s(r.xs, x-0.5)
+}
+
+// row returns the index of the grid line at `y`
+func (r *router) row(y float64) int {
+	return sort.SearchFloat64s(r.ys, y-0.5)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// segmentIndex identifies the grid segment starting at (i, j) going right
+// when `horizontal`, down otherwise
+func (r *router) segmentIndex(i, j int, horizontal bool) int {
+	index := (j*len(r.xs) + i) * 2
+	if !horizontal {
+		index++
+	}
+	return index
+}
+
+// isWithin reports whether `n` is `ancestor` or one of its descendants
+func isWithin(n, ancestor *node) bool {
+	for ; n != nil; n = n.parent {
+		if n == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+type routeState struct {
+	i, j, dir int
+	cost      float64
+	priority  float64
+	index     int
+}
+
+type routeQueue []*routeState
+
+func (q routeQueue) Len() int            { return len(q) }
+func (q routeQueue) Less(a, b int) bool  { return q[a].priority < q[b].priority }
+func (q routeQueue) Swap(a, b int)       { q[a], q[b] = q[b], q[a]; q[a].index = a; q[b].index = b }
+func (q *routeQueue) Push(x interface{}) { s := x.(*routeState); s.index = len(*q); *q = append(*q, s) }
+func (q *routeQueue) Pop() interface{} {
+	old := *q
+	s := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return s
+}
+
+// directions a path can take on the grid; noDirection marks the start
+var routeSteps = [4][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}}
+
+const noDirection = 4
+
+// route finds the cheapest orthogonal path between the centers of `from` and
+// `to`, charging for length, bends, grid segments already taken by other
+// links and the borders of groups the link doesn't start or end in, then
+// clips it to the borders of both nodes
+func (r *router) route(from, to *node) []point {
+	startI, startJ := r.column(from.x+from.w/2), r.row(from.y+from.h/2)
+	goalI, goalJ := r.column(to.x+to.w/2), r.row(to.y+to.h/2)
+	if startI >= len(r.xs) || goalI >= len(r.xs) || startJ >= len(r.ys) || goalJ >= len(r.ys) {
+		return nil
+	}
+
+	passable := func(key int) bool {
+		for _, b := range r.blockers[key] {
+			if !isWithin(b, from) && !isWithin(b, to) {
+				return false
+			}
+		}
+		return true
+	}
+	crossings := func(key int) int {
+		count := 0
+		for _, g := range r.borders[key] {
+			if !isWithin(from, g) && !isWithin(to, g) {
+				count++
+			}
+		}
+		return count
+	}
+	heuristic := func(i, j int) float64 {
+		return math.Abs(r.xs[i]-r.xs[goalI]) + math.Abs(r.ys[j]-r.ys[goalJ])
+	}
+	stateIndex := func(i, j, dir int) int {
+		return (j*len(r.xs)+i)*5 + dir
+	}
+
+	best := map[int]float64{}
+	previous := map[int]int{}
+	queue := &routeQueue{}
+	start := &routeState{i: startI, j: startJ, dir: noDirection, priority: heuristic(startI, startJ)}
+	best[stateIndex(startI, startJ, noDirection)] = 0
+	heap.Push(queue, start)
+
+	goal := -1
+	for queue.Len() > 0 {
+		s := heap.Pop(queue).(*routeState)
+		current := stateIndex(s.i, s.j, s.dir)
+		if s.cost > best[current] {
+			continue
+		}
+		if s.i == goalI && s.j == goalJ {
+			goal = current
+			break
+		}
+		for dir, step := range routeSteps {
+			i, j := s.i+step[0], s.j+step[1]
+			if i < 0 || j < 0 || i >= len(r.xs) || j >= len(r.ys) {
+				continue
+			}
+			key := r.segmentIndex(minInt(i, s.i), minInt(j, s.j), step[1] == 0)
+			if !passable(key) {
+				continue
+			}
+			cost := s.cost + math.Abs(r.xs[i]-r.xs[s.i]) + math.Abs(r.ys[j]-r.ys[s.j])
+			cost += crowdingPenalty * float64(r.used[key])
+			cost += crossingPenalty * float64(crossings(key))
+			if s.dir != noDirection && s.dir != dir {
+				cost += bendPenalty
+			}
+			next := stateIndex(i, j, dir)
+			if known, ok := best[next]; ok && known <= cost {
+				continue
+			}
+			best[next] = cost
+			previous[next] = current
+			heap.Push(queue, &routeState{i: i, j: j, dir: dir, cost: cost, priority: cost + heuristic(i, j)})
+		}
+	}
+	if goal < 0 {
+		return nil
+	}
+
+	var cells [][2]int
+	for state := goal; ; state = previous[state] {
+		cell := state / 5
+		cells = append([][2]int{{cell % len(r.xs), cell / len(r.xs)}}, cells...)
+		if state == stateIndex(startI, startJ, noDirection) {
+			break
+		}
+	}
+	var points []point
+	for k, cell := range cells {
+		if k > 0 {
+			prev := cells[k-1]
+			r.used[r.segmentIndex(minInt(cell[0], prev[0]), minInt(cell[1], prev[1]), cell[1] == prev[1])]++
+		}
+		points = append(points, point{r.xs[cell[0]], r.ys[cell[1]]})
+	}
+	return clipPath(simplifyPath(points), nodeRect(from), nodeRect(to))
+}
+
+// simplifyPath drops the points in the middle of straight runs
+func simplifyPath(points []point) []point {
+	if len(points) < 3 {
+		return points
+	}
+	result := []point{points[0]}
+	for k := 1; k < len(points)-1; k++ {
+		prev, next := result[len(result)-1], points[k+1]
+		collinear := (prev.X == points[k].X && points[k].X == next.X) || (prev.Y == points[k].Y && points[k].Y == next.Y)
+		if !collinear {
+			result = append(result, points[k])
+		}
+	}
+	return append(result, points[len(points)-1])
+}
+
+// exitPoint returns where the segment from `inside` to `outside` crosses the
+// border of `r`; segments are axis aligned
+func exitPoint(r rect, inside, outside point) point {
+	switch {
+	case outside.X > r.x1 && inside.X <= r.x1:
+		return point{r.x1, inside.Y}
+	case outside.X < r.x0 && inside.X >= r.x0:
+		return point{r.x0, inside.Y}
+	case outside.Y > r.y1 && inside.Y <= r.y1:
+		return point{inside.X, r.y1}
+	case outside.Y < r.y0 && inside.Y >= r.y0:
+		return point{inside.X, r.y0}
+	}
+	return inside
+}
+
+// clipPath cuts the parts of a path running inside its end nodes
+func clipPath(points []point, from, to rect) []point {
+	last := 0
+	for k, p := range points {
+		if from.contains(p.X, p.Y) {
+			last = k
+		}
+	}
+	if last == len(points)-1 {
+		return nil
+	}
+	points = append([]point{exitPoint(from, points[last], points[last+1])}, points[last+1:]...)
+
+	first := len(points) - 1
+	for k := len(points) - 1; k >= 0; k-- {
+		if to.contains(points[k].X, points[k].Y) {
+			first = k
+		}
+	}
+	if first == 0 {
+		return nil
+	}
+	return append(points[:first:first], exitPoint(to, points[first], points[first-1]))
+}
+
+type pathSegment struct {
+	path, index int
+	low, high   float64
+}
+
+// separateParallel spreads segments of different paths that run on the same
+// line over overlapping ranges, so they read as distinct links
+func separateParallel(paths [][]point) {
+	for _, vertical := range []bool{true, false} {
+		lines := map[float64][]pathSegment{}
+		for p, points := range paths {
+			for k := 0; k+1 < len(points); k++ {
+				a, b := points[k], points[k+1]
+				if vertical && a.X == b.X && a.Y != b.Y {
+					lines[a.X] = append(lines[a.X], pathSegment{p, k, math.Min(a.Y, b.Y), math.Max(a.Y, b.Y)})
+				} else if !vertical && a.Y == b.Y && a.X != b.X {
+					lines[a.Y] = append(lines[a.Y], pathSegment{p, k, math.Min(a.X, b.X), math.Max(a.X, b.X)})
+				}
+			}
+		}
+		for _, segments := range lines {
+			sort.Slice(segments, func(a, b int) bool { return segments[a].low < segments[b].low })
+			for start := 0; start < len(segments); {
+				end, high := start+1, segments[start].high
+				for end < len(segments) && segments[end].low < high {
+					high = math.Max(high, segments[end].high)
+					end++
+				}
+				cluster := segments[start:end]
+				for c, s := range cluster {
+					offset := (float64(c) - float64(len(cluster)-1)/2) * edgeSeparation
+					if vertical {
+						paths[s.path][s.index].X += offset
+						paths[s.path][s.index+1].X += offset
+					} else {
+						paths[s.path][s.index].Y += offset
+						paths[s.path][s.index+1].Y += offset
+					}
+				}
+				start = end
+			}
+		}
+	}
+}
+
+// groupHeaders returns placeholder nodes covering the labels of boundaries
+// and subgraphs, for links and link labels to keep clear of them
+func (dia *Diagram) groupHeaders() []*node {
+	var headers []*node
+	dia.useFont(dia.themedElementFont())
+	for _, n := range dia.nodes {
+		if n.isGroup() && n.Label != "" {
+			textWidth, textHeight := dia.measureText(n.Label)
+			headers = append(headers, &node{parent: n, x: n.x + groupPadding, y: n.y + groupPadding/2, w: textWidth, h: textHeight})
+		}
+	}
+	return headers
+}
+
+// routeLinks returns a path per link, in the order of dia.links
+func (dia *Diagram) routeLinks() [][]point {
+	paths := make([][]point, len(dia.links))
+	straight := func(l link) []point {
+		startX, startY := borderPoint(l.from, l.to.x+l.to.w/2, l.to.y+l.to.h/2)
+		endX, endY := borderPoint(l.to, l.from.x+l.from.w/2, l.from.y+l.from.h/2)
+		return []point{{startX, startY}, {endX, endY}}
+	}
+	if dia.edgeStyle == STRAIGHT {
+		for i, l := range dia.links {
+			paths[i] = straight(l)
+		}
+		return paths
+	}
+
+	obstacles := append(leaves(dia.root), dia.groupHeaders()...)
+	var groups []*node
+	for _, n := range dia.nodes {
+		if n.isGroup() {
+			groups = append(groups, n)
+		}
+	}
+	r := newRouter(obstacles, groups)
+	for i, l := range dia.links {
+		paths[i] = r.route(l.from, l.to)
+		if paths[i] == nil {
+			paths[i] = straight(l)
+		}
+	}
+	separateParallel(paths)
+	return paths
+}
+
+// placeLabels returns a center for each link label, trying the middle and
+// the quarters of every segment, longest first, and keeping the first spot
+// that covers neither a node, a group border nor an already placed label
+func (dia *Diagram) placeLabels(paths [][]point) []point {
+	var taken []rect
+	for _, n := range append(leaves(dia.root), dia.groupHeaders()...) {
+		taken = append(taken, nodeRect(n))
+	}
+	for _, n := range dia.nodes {
+		if n.isGroup() {
+			b := nodeRect(n)
+			taken = append(taken,
+				rect{b.x0, b.y0, b.x1, b.y0}, rect{b.x0, b.y1, b.x1, b.y1},
+				rect{b.x0, b.y0, b.x0, b.y1}, rect{b.x1, b.y0, b.x1, b.y1})
+		}
+	}
+	dia.useFont(dia.themedLabelFont())
+	centers := make([]point, len(paths))
+	for p, l := range dia.links {
+		if l.Label == "" || len(paths[p]) < 2 {
+			continue
+		}
+		textWidth, textHeight := dia.measureText(l.Label)
+		points := paths[p]
+		var candidates []point
+		order := make([]int, len(points)-1)
+		for k := range order {
+			order[k] = k
+		}
+		length := func(k int) float64 {
+			return math.Hypot(points[k+1].X-points[k].X, points[k+1].Y-points[k].Y)
+		}
+		sort.SliceStable(order, func(a, b int) bool { return length(order[a]) > length(order[b]) })
+		for _, k := range order {
+			for _, t := range []float64{0.5, 0.25, 0.75} {
+				candidates = append(candidates, point{
+					points[k].X + (points[k+1].X-points[k].X)*t,
+					points[k].Y + (points[k+1].Y-points[k].Y)*t,
+				})
+			}
+		}
+
+		centers[p] = candidates[0]
+		for _, c := range candidates {
+			box := rect{c.X - textWidth/2 - 3, c.Y - textHeight/2 - 3, c.X + textWidth/2 + 3, c.Y + textHeight/2 + 3}
+			free := true
+			for _, t := range taken {
+				if box.overlaps(t) {
+					free = false
+					break
+				}
+			}
+			if free {
+				centers[p] = c
+				break
+			}
+		}
+		c := centers[p]
+		taken = append(taken, rect{c.X - textWidth/2 - 3, c.Y - textHeight/2 - 3, c.X + textWidth/2 + 3, c.Y + textHeight/2 + 3})
+	}
+	return centers
+}
+
+// drawSpline strokes a path through the corners of an orthogonal route,
+// rounding each corner with a curve
+func (dia *Diagram) drawSpline(points []point, directional bool) {
+	if len(points) < 3 {
+		dia.drawPath(points, directional)
+		return
+	}
+	dia.dc.MoveTo(points[0].X, points[0].Y)
+	for k := 1; k < len(points)-1; k++ {
+		prev, corner, next := points[k-1], points[k], points[k+1]
+		in := math.Min(cornerRadius, math.Hypot(corner.X-prev.X, corner.Y-prev.Y)/2)
+		out := math.Min(cornerRadius, math.Hypot(next.X-corner.X, next.Y-corner.Y)/2)
+		before := towards(corner, prev, in)
+		after := towards(corner, next, out)
+		dia.dc.LineTo(before.X, before.Y)
+		dia.dc.QuadraticTo(corner.X, corner.Y, after.X, after.Y)
+	}
+	last := points[len(points)-1]
+	dia.dc.LineTo(last.X, last.Y)
+	dia.dc.Stroke()
+	if directional {
+		prev := points[len(points)-2]
+		dia.drawArrowHead(prev.X, prev.Y, last.X, last.Y)
+	}
+}
+
+// towards returns the point `distance` away from `from` in the direction of `to`
+func towards(from, to point, distance float64) point {
+	length := math.Hypot(to.X-from.X, to.Y-from.Y)
+	if length == 0 {
+		return from
+	}
+	return point{from.X + (to.X-from.X)*distance/length, from.Y + (to.Y-from.Y)*distance/length}
+}
@@ -0,0 +1,206 @@
+package zml
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// box returns a node of `parent` at (x, y), `w` by `h`
+func box(id string, parent *node, x, y, w, h float64) *node {
+	n := &node{ID: id, Label: id, parent: parent, x: x, y: y, w: w, h: h}
+	parent.children = append(parent.children, n)
+	return n
+}
+
+// enters reports whether the segments of `path` run inside `r`
+func enters(path []point, r rect) bool {
+	for k := 0; k+1 < len(path); k++ {
+		a, b := path[k], path[k+1]
+		segment := rect{math.Min(a.X, b.X), math.Min(a.Y, b.Y), math.Max(a.X, b.X), math.Max(a.Y, b.Y)}
+		if segment.overlaps(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRouteAvoidsNodes(t *testing.T) {
+	// a 3x3 grid of boxes, routed between every pair
+	root := &node{Type: BOUNDARY}
+	var nodes []*node
+	for row := 0; row < 3; row++ {
+		for col := 0; col < 3; col++ {
+			nodes = append(nodes, box(string(rune('a'+row*3+col)), root, float64(col)*200, float64(row)*150, 100, 50))
+		}
+	}
+	r := newRouter(nodes, nil)
+	for _, from := range nodes {
+		for _, to := range nodes {
+			if from == to {
+				continue
+			}
+			path := r.route(from, to)
+			if len(path) < 2 {
+				t.Errorf("%s -> %s: no path", from.ID, to.ID)
+				continue
+			}
+			for k := 0; k+1 < len(path); k++ {
+				if path[k].X != path[k+1].X && path[k].Y != path[k+1].Y {
+					t.Errorf("%s -> %s: segment %v %v isn't horizontal or vertical", from.ID, to.ID, path[k], path[k+1])
+				}
+			}
+			for _, n := range nodes {
+				if n != from && n != to && enters(path, nodeRect(n)) {
+					t.Errorf("%s -> %s: %v runs through %s", from.ID, to.ID, path, n.ID)
+				}
+			}
+			// the path starts and ends on the borders of its nodes
+			if first := path[0]; !nodeRect(from).contains(first.X, first.Y) || enters(path, nodeRect(from)) {
+				t.Errorf("%s -> %s: %v doesn't start on the border of %s", from.ID, to.ID, path, from.ID)
+			}
+			if last := path[len(path)-1]; !nodeRect(to).contains(last.X, last.Y) || enters(path, nodeRect(to)) {
+				t.Errorf("%s -> %s: %v doesn't end on the border of %s", from.ID, to.ID, path, to.ID)
+			}
+		}
+	}
+}
+
+func TestRouteAvoidsUnrelatedGroups(t *testing.T) {
+	// a and b on either side of a group standing between them
+	root := &node{Type: BOUNDARY}
+	a := box("a", root, 0, 100, 100, 50)
+	b := box("b", root, 500, 100, 100, 50)
+	group := box("group", root, 200, 0, 200, 300)
+	group.Type = BOUNDARY
+	inner := box("inner", group, 250, 20, 100, 50)
+	r := newRouter([]*node{a, b, inner}, []*node{group})
+
+	path := r.route(a, b)
+	if len(path) < 2 {
+		t.Fatal("a -> b: no path")
+	}
+	border := nodeRect(group)
+	border.x0, border.y0, border.x1, border.y1 = border.x0-1, border.y0-1, border.x1+1, border.y1+1
+	if enters(path, border) {
+		t.Errorf("a -> b: %v crosses the group", path)
+	}
+
+	// links to the group or into it do cross its border
+	for _, to := range []*node{group, inner} {
+		if path := r.route(a, to); len(path) < 2 {
+			t.Errorf("a -> %s: no path", to.ID)
+		}
+	}
+}
+
+func TestSimplifyPath(t *testing.T) {
+	tests := []struct {
+		in, want []point
+	}{
+		{nil, nil},
+		{[]point{{0, 0}, {10, 0}}, []point{{0, 0}, {10, 0}}},
+		{[]point{{0, 0}, {5, 0}, {10, 0}, {20, 0}}, []point{{0, 0}, {20, 0}}},
+		{[]point{{0, 0}, {10, 0}, {10, 5}, {10, 10}, {20, 10}}, []point{{0, 0}, {10, 0}, {10, 10}, {20, 10}}},
+	}
+	for _, tt := range tests {
+		if got := simplifyPath(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("simplifyPath(%v) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestClipPath(t *testing.T) {
+	from, to := rect{0, 0, 20, 20}, rect{100, 40, 120, 60}
+	tests := []struct {
+		in, want []point
+	}{
+		// from the center of one box to the center of the other
+		{[]point{{10, 10}, {110, 10}, {110, 50}}, []point{{20, 10}, {110, 10}, {110, 40}}},
+		{[]point{{10, 10}, {10, 50}, {110, 50}}, []point{{10, 20}, {10, 50}, {100, 50}}},
+		// a path that never leaves the start box has nothing to draw
+		{[]point{{5, 5}, {15, 15}}, nil},
+	}
+	for _, tt := range tests {
+		if got := clipPath(tt.in, from, to); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("clipPath(%v) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSeparateParallel(t *testing.T) {
+	paths := [][]point{
+		{{0, 0}, {100, 0}, {100, 100}},
+		{{200, 50}, {100, 50}, {100, 150}},
+		// on the same line but further down, without overlapping
+		{{100, 200}, {100, 300}},
+	}
+	separateParallel(paths)
+	a, b := paths[0][1].X, paths[1][1].X
+	if a == b || paths[0][2].X != a || paths[1][2].X != b {
+		t.Fatalf("overlapping segments weren't moved apart as a whole: %v, %v", paths[0], paths[1])
+	}
+	if gap := b - a; gap != edgeSeparation && gap != -edgeSeparation {
+		t.Errorf("overlapping segments are %g apart, want %g", gap, edgeSeparation)
+	}
+	if paths[2][0].X != 100 || paths[2][1].X != 100 {
+		t.Errorf("a segment overlapping no other moved: %v", paths[2])
+	}
+}
+
+func TestPlaceLabels(t *testing.T) {
+	in := `type: flowchart
+node cart: Cart
+subgraph pay: Payments
+    decision fraud: Looks legit?
+    node charge: Charge card
+    subgraph ledger: Ledger
+        node entry: Write entry
+        node balance: Update balance
+    end
+    fraud -> charge: yes
+    charge -> entry: write
+    entry -> balance: then
+end
+node reject: Reject
+node receipt: Email receipt
+cart -> fraud: pay
+fraud -> reject: no
+ledger -> receipt: done`
+	dia := NewDiagram("test")
+	dia.ProcessData([]byte(in))
+	dia.dc = newRasterCanvas(1024, 1024, 1)
+	dia.layout()
+	paths := dia.routeLinks()
+	centers := dia.placeLabels(paths)
+
+	// "no" leaves Payments but has no business in Ledger
+	for i, l := range dia.links {
+		if l.Label == "no" && enters(paths[i], nodeRect(dia.nodes["ledger"])) {
+			t.Errorf("fraud -> reject runs through the ledger subgraph: %v", paths[i])
+		}
+	}
+
+	dia.useFont(dia.themedLabelFont())
+	var placed []rect
+	for i, l := range dia.links {
+		w, h := dia.measureText(l.Label)
+		c := centers[i]
+		label := rect{c.X - w/2, c.Y - h/2, c.X + w/2, c.Y + h/2}
+		for id, n := range dia.nodes {
+			b := nodeRect(n)
+			if !n.isGroup() && label.overlaps(b) {
+				t.Errorf("label %q covers %s", l.Label, id)
+			}
+			if n.isGroup() && label.overlaps(b) && !(label.x0 > b.x0 && label.x1 < b.x1 && label.y0 > b.y0 && label.y1 < b.y1) {
+				t.Errorf("label %q is on the border of %s", l.Label, id)
+			}
+		}
+		for _, p := range placed {
+			if label.overlaps(p) {
+				t.Errorf("label %q covers another label", l.Label)
+			}
+		}
+		placed = append(placed, label)
+	}
+}
@@ -0,0 +1,128 @@
+package zml
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// Style overrides the theme for a single participant or message. Zero values
+// keep the theme's setting.
+type Style struct {
+	// Fill is the background of a participant box
+	Fill Color
+	// Color is the border of a participant box, or the line of a message
+	Color Color
+	// Text is the label color; messages fall back to Color
+	Text Color
+	// Bold draws thicker lines and bold labels
+	Bold bool
+}
+
+var styleRegexp = regexp.MustCompile(`\s*\{([^{}]*)\}\s*$`)
+
+// clearColor is what fully transparent style values become: it draws
+// nothing like the zero Color, which mergeStyle reads as unset
+var clearColor = Color{Red: 255, Green: 255, Blue: 255}
+
+// styleColor parses a style value, allowing a `#` in front of color names
+// as in `participant DB #lightblue`
+func styleColor(s string) (Color, error) {
+	if name := strings.TrimPrefix(s, "#"); name != s {
+		if c, ok := colornames[strings.ToLower(name)]; ok {
+			return c, nil
+		}
+	}
+	c, err := ParseColor(s)
+	if err == nil && c.Alpha == 0 {
+		return clearColor, nil
+	}
+	return c, err
+}
+
+// parseStyle reads a comma separated attribute list, e.g. "color: red, bold"
+func parseStyle(attrs string) (Style, error) {
+	var style Style
+	depth := 0
+	// commas inside rgb(...) and the like don't separate attributes
+	list := strings.FieldsFunc(attrs, func(r rune) bool {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+		return r == ',' && depth == 0
+	})
+	for _, attr := range list {
+		attr = strings.TrimSpace(attr)
+		if attr == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(attr, ":")
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+		var err error
+		switch key {
+		case "fill", "background":
+			style.Fill, err = styleColor(value)
+		case "color", "stroke":
+			style.Color, err = styleColor(value)
+		case "text":
+			style.Text, err = styleColor(value)
+		case "bold":
+			style.Bold = true
+		default:
+			err = fmt.Errorf("unknown style attribute \"%s\"", key)
+		}
+		if err != nil {
+			return style, err
+		}
+	}
+	return style, nil
+}
+
+// splitStyle removes a trailing `{...}` attribute list from `line` and
+// returns the rest of the line with the parsed style. A list that doesn't
+// parse is left in the line, as text such as `returns {ok}`.
+func splitStyle(line string) (string, Style) {
+	loc := styleRegexp.FindStringSubmatchIndex(line)
+	if loc == nil {
+		return line, Style{}
+	}
+	style, err := parseStyle(line[loc[2]:loc[3]])
+	if err != nil {
+		log.Printf("%s: %s, keeping it as text", line, err.Error())
+		return line, Style{}
+	}
+	return line[:loc[0]], style
+}
+
+// mergeStyle returns `s` with anything it leaves unset taken from `fallback`
+func mergeStyle(s, fallback Style) Style {
+	if s.Fill == (Color{}) {
+		s.Fill = fallback.Fill
+	}
+	if s.Color == (Color{}) {
+		s.Color = fallback.Color
+	}
+	if s.Text == (Color{}) {
+		s.Text = fallback.Text
+	}
+	s.Bold = s.Bold || fallback.Bold
+	return s
+}
+
+// SetElemenetStyle overrides the theme for the participant `name`, adding it
+// when missing
+func (dia *Diagram) SetElemenetStyle(name string, style Style) {
+	dia.AddElemenets(name)
+	for i := range dia.elemenets {
+		if dia.elemenets[i].Name == name {
+			dia.elemenets[i].Style = style
+		}
+	}
+	if dia.debug {
+		log.Printf("SetElemenetStyle(): {name: %s, style: %+v}\n", name, style)
+	}
+}
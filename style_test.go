@@ -0,0 +1,65 @@
+package zml
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitStyle(t *testing.T) {
+	tests := []struct {
+		in, rest string
+		style    Style
+	}{
+		{"A->B: hi", "A->B: hi", Style{}},
+		{"A->B: declined {color: red, bold}", "A->B: declined", Style{Color: Color{255, 0, 0, 255}, Bold: true}},
+		{"participant DB {fill: rgb(0, 0, 255), text: #fff}", "participant DB", Style{Fill: Color{0, 0, 255, 255}, Text: Color{255, 255, 255, 255}}},
+		{"participant DB {fill: transparent}", "participant DB", Style{Fill: clearColor}},
+		// lists that don't parse are text
+		{"A->B: returns {ok}", "A->B: returns {ok}", Style{}},
+		{"A->B: {color: notacolor}", "A->B: {color: notacolor}", Style{}},
+	}
+	for _, tt := range tests {
+		rest, style := splitStyle(tt.in)
+		if rest != tt.rest || style != tt.style {
+			t.Errorf("splitStyle(%q) = %q, %+v, want %q, %+v", tt.in, rest, style, tt.rest, tt.style)
+		}
+	}
+}
+
+func TestMergeStyle(t *testing.T) {
+	red, blue := Color{255, 0, 0, 255}, Color{0, 0, 255, 255}
+	theme := Style{Fill: red, Color: red, Text: red}
+	tests := []struct {
+		in, want Style
+	}{
+		{Style{}, theme},
+		{Style{Fill: blue, Bold: true}, Style{Fill: blue, Color: red, Text: red, Bold: true}},
+		// transparent is a color of its own, not unset
+		{Style{Fill: clearColor}, Style{Fill: clearColor, Color: red, Text: red}},
+	}
+	for _, tt := range tests {
+		if got := mergeStyle(tt.in, theme); got != tt.want {
+			t.Errorf("mergeStyle(%+v) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestProcessSequenceStyles(t *testing.T) {
+	dia := NewDiagram("test")
+	dia.ProcessData([]byte(`participant DB {fill: transparent}
+participant Gateway #lightblue
+Gateway->>DB: returns {ok}
+DB-->>Gateway: declined {color: red}`))
+	if got := dia.elemenets[0].Style.Fill; got.Alpha != 0 || got == (Color{}) {
+		t.Errorf("DB fill = %v, want transparent and set", got)
+	}
+	if got, want := dia.elemenets[1].Style.Fill, colornames["lightblue"]; got != want {
+		t.Errorf("Gateway fill = %v, want %v", got, want)
+	}
+	if got := strings.TrimSpace(dia.edges[0].Label); got != "returns {ok}" {
+		t.Errorf("label = %q, want %q", got, "returns {ok}")
+	}
+	if got := dia.edges[1]; strings.TrimSpace(got.Label) != "declined" || got.Style.Color != (Color{255, 0, 0, 255}) {
+		t.Errorf("styled message = %q %+v, want \"declined\" in red", got.Label, got.Style)
+	}
+}
@@ -0,0 +1,191 @@
+package zml
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/png"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	// KITTY draws images in terminals with the Kitty graphics protocol
+	KITTY = "kitty"
+	// SIXEL draws images in terminals as DEC Sixel graphics
+	SIXEL = "sixel"
+
+	// kittyChunkSize is the most base64 data a Kitty graphics escape may carry
+	kittyChunkSize = 4096
+)
+
+// TerminalGraphics guesses from the environment how the terminal draws
+// images: KITTY, SIXEL or "" when it can't. ZML_PREVIEW=kitty, sixel or text
+// overrides the guess.
+func TerminalGraphics() string {
+	switch strings.ToLower(os.Getenv("ZML_PREVIEW")) {
+	case KITTY:
+		return KITTY
+	case SIXEL:
+		return SIXEL
+	case "text", TXT:
+		return ""
+	}
+	term, program := os.Getenv("TERM"), os.Getenv("TERM_PROGRAM")
+	switch {
+	case os.Getenv("KITTY_WINDOW_ID") != "", term == "xterm-kitty", term == "xterm-ghostty",
+		program == "WezTerm", program == "ghostty":
+		return KITTY
+	case strings.Contains(term, "sixel"), strings.HasPrefix(term, "foot"), strings.HasPrefix(term, "mlterm"),
+		strings.HasPrefix(term, "yaft"), program == "mlterm", program == "iTerm.app":
+		return SIXEL
+	}
+	return ""
+}
+
+// Preview draws the diagram to `w`, a terminal, as Render would draw it to
+// files: as an image when TerminalGraphics finds a way to, otherwise as text
+func (dia *Diagram) Preview(w io.Writer, width, height float64, color string) {
+	defer func(format string) {
+		dia.format = format
+		dia.preview = nil
+	}(dia.format)
+	dia.preview = w
+	dia.previewGraphics = TerminalGraphics()
+	if dia.previewGraphics == "" {
+		dia.format = TXT
+	} else {
+		dia.format = PNG
+	}
+	dia.Render(width, height, color)
+}
+
+// writeTerminalImage draws `img` to `w` with the terminal graphics protocol
+// `graphics`, on a line of its own
+func writeTerminalImage(w io.Writer, graphics string, img image.Image) error {
+	out := bufio.NewWriter(w)
+	var err error
+	if graphics == KITTY {
+		err = writeKitty(out, img)
+	} else {
+		err = writeSixel(out, img)
+	}
+	if err != nil {
+		return err
+	}
+	out.WriteString("\n")
+	return out.Flush()
+}
+
+// writeKitty sends `img` as a PNG in Kitty graphics escapes, split in chunks
+func writeKitty(w *bufio.Writer, img image.Image) error {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return err
+	}
+	data := base64.StdEncoding.EncodeToString(buf.Bytes())
+	for first := true; first || len(data) > 0; first = false {
+		chunk := data
+		if len(chunk) > kittyChunkSize {
+			chunk = chunk[:kittyChunkSize]
+		}
+		data = data[len(chunk):]
+		more := 0
+		if len(data) > 0 {
+			more = 1
+		}
+		if first {
+			fmt.Fprintf(w, "\x1b_Gf=100,a=T,m=%d;%s\x1b\\", more, chunk)
+		} else {
+			fmt.Fprintf(w, "\x1b_Gm=%d;%s\x1b\\", more, chunk)
+		}
+	}
+	return nil
+}
+
+// writeSixel sends `img` as Sixel graphics: bands of six rows, each drawn
+// one color at a time, in the 256 colors of the Plan 9 palette. Pixels less
+// than half opaque are left unset, showing the terminal's background, and
+// the others are blended onto white.
+func writeSixel(w *bufio.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+	width, height := rgba.Rect.Dx(), rgba.Rect.Dy()
+	unset := make([]bool, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			px := rgba.Pix[y*rgba.Stride+x*4 : y*rgba.Stride+x*4+4]
+			unset[y*width+x] = px[3] < 0x80
+			// premultiplied, so white shows through by 0xff - alpha
+			for i := 0; i < 3; i++ {
+				px[i] += 0xff - px[3]
+			}
+			px[3] = 0xff
+		}
+	}
+	paletted := image.NewPaletted(rgba.Rect, palette.Plan9)
+	draw.Draw(paletted, paletted.Bounds(), rgba, image.Point{}, draw.Src)
+
+	// DCS with pixels left unset painted in the background color (P2=0), then
+	// square pixels and the size
+	fmt.Fprintf(w, "\x1bP0;0;0q\"1;1;%d;%d", width, height)
+	for i, c := range paletted.Palette {
+		r, g, b, _ := c.RGBA()
+		fmt.Fprintf(w, "#%d;2;%d;%d;%d", i, r*100/0xffff, g*100/0xffff, b*100/0xffff)
+	}
+
+	sixels := make([][]byte, len(paletted.Palette))
+	for top := 0; top < height; top += 6 {
+		var used []int
+		for y := top; y < top+6 && y < height; y++ {
+			for x := 0; x < width; x++ {
+				if unset[y*width+x] {
+					continue
+				}
+				i := paletted.Pix[y*paletted.Stride+x]
+				if sixels[i] == nil {
+					sixels[i] = make([]byte, width)
+					used = append(used, int(i))
+				}
+				sixels[i][x] |= 1 << (y - top)
+			}
+		}
+		for n, i := range used {
+			if n > 0 {
+				w.WriteString("$")
+			}
+			fmt.Fprintf(w, "#%d", i)
+			writeSixelRow(w, sixels[i])
+			sixels[i] = nil
+		}
+		w.WriteString("-")
+	}
+	w.WriteString("\x1b\\")
+	return nil
+}
+
+// writeSixelRow writes the sixels of a color across a band, with runs of the
+// same sixel shortened to !<count><sixel>
+func writeSixelRow(w *bufio.Writer, row []byte) {
+	for x := 0; x < len(row); {
+		run := 1
+		for x+run < len(row) && row[x+run] == row[x] {
+			run++
+		}
+		sixel := row[x] + '?'
+		if run > 3 {
+			fmt.Fprintf(w, "!%d%c", run, sixel)
+		} else {
+			for i := 0; i < run; i++ {
+				w.WriteByte(sixel)
+			}
+		}
+		x += run
+	}
+}
@@ -0,0 +1,227 @@
+package zml
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// decodeSixel reads back what writeSixel wrote: the size from the raster
+// attributes, the color registers as RGB percentages and, for every pixel,
+// the register it was drawn with or -1 when left unset
+func decodeSixel(t *testing.T, data string) (registers map[int][3]int, pixels [][]int) {
+	t.Helper()
+	header := regexp.MustCompile(`^\x1bP0;0;0q"1;1;(\d+);(\d+)`).FindStringSubmatch(data)
+	if header == nil || !strings.HasSuffix(data, "\x1b\\") {
+		t.Fatalf("not a sixel image: %q", data)
+	}
+	width, _ := strconv.Atoi(header[1])
+	height, _ := strconv.Atoi(header[2])
+	pixels = make([][]int, height)
+	for y := range pixels {
+		pixels[y] = make([]int, width)
+		for x := range pixels[y] {
+			pixels[y][x] = -1
+		}
+	}
+	registers = map[int][3]int{}
+	body := data[len(header[0]) : len(data)-2]
+	number := func(i int) (int, int) {
+		j := i
+		for j < len(body) && body[j] >= '0' && body[j] <= '9' {
+			j++
+		}
+		n, err := strconv.Atoi(body[i:j])
+		if err != nil {
+			t.Fatalf("expected a number at %d of %q", i, body)
+		}
+		return n, j
+	}
+	current, x, top := -1, 0, 0
+	for i := 0; i < len(body); {
+		switch c := body[i]; {
+		case c == '#':
+			n, j := number(i + 1)
+			if strings.HasPrefix(body[j:], ";2;") {
+				var rgb [3]int
+				j += 2
+				for k := range rgb {
+					rgb[k], j = number(j + 1)
+				}
+				registers[n] = rgb
+			} else {
+				current, x = n, 0
+			}
+			i = j
+		case c == '$':
+			x = 0
+			i++
+		case c == '-':
+			x, top = 0, top+6
+			i++
+		case c == '!' || c >= '?' && c <= '~':
+			run := 1
+			if c == '!' {
+				run, i = number(i + 1)
+				c = body[i]
+			}
+			if _, ok := registers[current]; !ok {
+				t.Fatalf("sixel drawn with undefined register %d", current)
+			}
+			for n := 0; n < run; n, x = n+1, x+1 {
+				for bit := 0; bit < 6; bit++ {
+					if (c-'?')&(1<<bit) == 0 {
+						continue
+					}
+					if x >= width || top+bit >= height {
+						t.Fatalf("sixel at %d,%d outside of %dx%d", x, top+bit, width, height)
+					}
+					if pixels[top+bit][x] != -1 {
+						t.Fatalf("pixel %d,%d drawn twice", x, top+bit)
+					}
+					pixels[top+bit][x] = current
+				}
+			}
+			i++
+		default:
+			t.Fatalf("unexpected %q in sixel data", c)
+		}
+	}
+	return registers, pixels
+}
+
+func TestWriteSixel(t *testing.T) {
+	red, blue := color.NRGBA{0xff, 0, 0, 0xff}, color.NRGBA{0, 0, 0xff, 0xff}
+	// 8 rows make two bands; the first row is a run of red
+	img := image.NewNRGBA(image.Rect(0, 0, 7, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 7; x++ {
+			switch {
+			case y == 0 || x == 0:
+				img.Set(x, y, red)
+			case y == 7:
+				img.Set(x, y, blue)
+			case x == 6:
+				// less than half opaque, left to the terminal
+				img.Set(x, y, color.NRGBA{0, 0, 0, 0x40})
+			case x == 5:
+				// half opaque black blends to grey
+				img.Set(x, y, color.NRGBA{0, 0, 0, 0x80})
+			default:
+				img.Set(x, y, color.White)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	if err := writeSixel(w, img); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+	if !strings.Contains(buf.String(), "!6@") {
+		t.Errorf("the first row of red isn't written as a run: %q", buf.String())
+	}
+	registers, pixels := decodeSixel(t, buf.String())
+	if len(pixels) != 8 || len(pixels[0]) != 7 {
+		t.Fatalf("decoded a %dx%d image, want 7x8", len(pixels[0]), len(pixels))
+	}
+	for y, row := range pixels {
+		for x, i := range row {
+			var want string
+			switch {
+			case y == 0 || x == 0:
+				want = "red"
+			case y == 7:
+				want = "blue"
+			case x == 6:
+				want = "unset"
+			case x == 5:
+				want = "grey"
+			default:
+				want = "white"
+			}
+			got := "unset"
+			if i >= 0 {
+				switch rgb := registers[i]; {
+				case rgb == [3]int{100, 0, 0}:
+					got = "red"
+				case rgb == [3]int{0, 0, 100}:
+					got = "blue"
+				case rgb == [3]int{100, 100, 100}:
+					got = "white"
+				case rgb[0] == rgb[1] && rgb[1] == rgb[2] && rgb[0] > 40 && rgb[0] < 60:
+					got = "grey"
+				default:
+					got = strconv.Itoa(rgb[0]) + "," + strconv.Itoa(rgb[1]) + "," + strconv.Itoa(rgb[2])
+				}
+			}
+			if got != want {
+				t.Errorf("pixel %d,%d is %s, want %s", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestWriteKitty(t *testing.T) {
+	escape := regexp.MustCompile(`\x1b_G([^;]*);([^\x1b]*)\x1b\\`)
+	for _, size := range []int{4, 120} {
+		// noise doesn't compress, so the larger image takes several chunks
+		img := image.NewNRGBA(image.Rect(0, 0, size, size))
+		rand.New(rand.NewSource(1)).Read(img.Pix)
+
+		var buf bytes.Buffer
+		w := bufio.NewWriter(&buf)
+		if err := writeKitty(w, img); err != nil {
+			t.Fatal(err)
+		}
+		w.Flush()
+		escapes := escape.FindAllStringSubmatch(buf.String(), -1)
+		if joined := len(strings.Join(escape.FindAllString(buf.String(), -1), "")); joined != buf.Len() {
+			t.Fatalf("%dx%d: %d bytes outside of graphics escapes", size, size, buf.Len()-joined)
+		}
+		if size > 4 && len(escapes) < 2 {
+			t.Errorf("%dx%d: sent in %d chunk, want several", size, size, len(escapes))
+		}
+		var data string
+		for i, e := range escapes {
+			want := "m=1"
+			if i == 0 {
+				want = "f=100,a=T," + want
+			}
+			if i == len(escapes)-1 {
+				want = strings.Replace(want, "m=1", "m=0", 1)
+			}
+			if e[1] != want {
+				t.Errorf("%dx%d: chunk %d has keys %q, want %q", size, size, i, e[1], want)
+			}
+			if len(e[2]) > kittyChunkSize {
+				t.Errorf("%dx%d: chunk %d carries %d bytes", size, size, i, len(e[2]))
+			}
+			data += e[2]
+		}
+		decoded, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := png.Decode(bytes.NewReader(decoded))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				if g, w := color.NRGBAModel.Convert(got.At(x, y)), img.At(x, y); g != w {
+					t.Fatalf("%dx%d: pixel %d,%d is %v, want %v", size, size, x, y, g, w)
+				}
+			}
+		}
+	}
+}
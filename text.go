@@ -0,0 +1,332 @@
+package zml
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/rivo/uniseg"
+)
+
+// textGlyphs are the characters text diagrams are drawn with
+type textGlyphs struct {
+	horizontal, vertical                       string
+	topLeft, topRight, bottomLeft, bottomRight string
+	teeDown, teeUp, arrowRight, arrowLeft      string
+}
+
+var (
+	unicodeGlyphs = textGlyphs{"─", "│", "┌", "┐", "└", "┘", "┬", "┴", "▶", "◀"}
+	asciiGlyphs   = textGlyphs{"-", "|", "+", "+", "+", "+", "+", "+", ">", "<"}
+)
+
+// textCell is a character cell of a text diagram: a grapheme cluster, ""
+// for the second column of a wide character, and its color, nil for the
+// terminal's
+type textCell struct {
+	text  string
+	color *Color
+}
+
+// textGrid is a text diagram being drawn, growing as cells are written
+type textGrid struct {
+	rows [][]textCell
+}
+
+// set writes `s`, a single column character, at column x of row y
+func (g *textGrid) set(x, y int, s string, color *Color) {
+	for len(g.rows) <= y {
+		g.rows = append(g.rows, nil)
+	}
+	for len(g.rows[y]) <= x {
+		g.rows[y] = append(g.rows[y], textCell{text: " "})
+	}
+	g.rows[y][x] = textCell{text: s, color: color}
+}
+
+// write writes `s` from column x of row y, giving wide characters two columns
+func (g *textGrid) write(x, y int, s string, color *Color) {
+	for state := -1; len(s) > 0; {
+		var cluster string
+		var boundaries int
+		cluster, s, boundaries, state = uniseg.StepString(s, state)
+		g.set(x, y, cluster, color)
+		x++
+		for w := boundaries >> uniseg.ShiftWidth; w > 1; w-- {
+			g.set(x, y, "", color)
+			x++
+		}
+	}
+}
+
+// String returns the grid's rows without trailing spaces, colored with ANSI
+// escape codes when `colors` is set
+func (g *textGrid) String(colors bool) string {
+	var sb strings.Builder
+	for _, row := range g.rows {
+		var line strings.Builder
+		var current *Color
+		for _, cell := range row {
+			if colors && cell.color != current && (cell.color == nil || current == nil || *cell.color != *current) {
+				if cell.color == nil {
+					line.WriteString("\x1b[0m")
+				} else {
+					fmt.Fprintf(&line, "\x1b[38;2;%d;%d;%dm", cell.color.Red, cell.color.Green, cell.color.Blue)
+				}
+				current = cell.color
+			}
+			line.WriteString(cell.text)
+		}
+		if current != nil {
+			line.WriteString("\x1b[0m")
+		}
+		sb.WriteString(strings.TrimRight(line.String(), " "))
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// SetASCII draws text diagrams with ASCII characters only, for places that
+// mangle box-drawing characters
+func (dia *Diagram) SetASCII(ascii bool) {
+	dia.ascii = ascii
+}
+
+// SetANSIColors colors text diagrams with ANSI escape codes, for terminals
+func (dia *Diagram) SetANSIColors(colors bool) {
+	dia.ansiColors = colors
+}
+
+// textColor returns `c` for a textCell, nil when it's unset or transparent
+func textColor(c Color) *Color {
+	if c.Alpha == 0 {
+		return nil
+	}
+	return &c
+}
+
+// textLines returns the lines of a label as plain text, none for no label
+func textLines(label string) []string {
+	var lines []string
+	if label == "" {
+		return nil
+	}
+	for _, line := range lineBreakRegexp.Split(label, -1) {
+		lines = append(lines, strings.TrimSpace(plainText(parseRichText(line))))
+	}
+	return lines
+}
+
+// textWidth returns the number of columns the widest of `lines` takes
+func textWidth(lines []string) int {
+	width := 0
+	for _, line := range lines {
+		if w := uniseg.StringWidth(line); w > width {
+			width = w
+		}
+	}
+	return width
+}
+
+// renderText writes the diagram as text to `filename`, or to the terminal
+// when previewing
+func (dia *Diagram) renderText(filename string) {
+	if err := dia.CheckFormat(); err != nil {
+		log.Printf(err.Error())
+		return
+	}
+	if dia.preview != nil {
+		if _, err := io.WriteString(dia.preview, dia.sequenceText()); err != nil {
+			log.Printf(err.Error())
+		}
+		return
+	}
+	if err := os.WriteFile(filename, []byte(dia.sequenceText()), 0644); err != nil {
+		log.Printf(err.Error())
+		return
+	}
+	if dia.debug {
+		log.Printf("Saved to %s\n", filename)
+	}
+}
+
+// sequenceText draws a sequence diagram with box-drawing characters:
+// participant boxes above and below their lifelines, with each message's
+// label above its arrow
+func (dia *Diagram) sequenceText() string {
+	glyphs := unicodeGlyphs
+	if dia.ascii {
+		glyphs = asciiGlyphs
+	}
+	grid := &textGrid{}
+
+	// lifelines are at least far enough apart for the boxes, with two
+	// spaces between them, and for the labels of the messages between them
+	index := map[string]int{}
+	boxWidths := make([]int, len(dia.elemenets))
+	gaps := make([]int, len(dia.elemenets))
+	for i, p := range dia.elemenets {
+		index[p.Name] = i
+		boxWidths[i] = uniseg.StringWidth(p.Name) + 4
+		if i > 0 {
+			gaps[i] = boxWidths[i-1] - boxWidths[i-1]/2 + 2 + boxWidths[i]/2
+		}
+	}
+	type span struct{ from, to, width int }
+	var spans []span
+	rightMargin := 0
+	for _, e := range dia.edges {
+		from, to := index[e.from.Name], index[e.to.Name]
+		width := textWidth(textLines(e.Label))
+		switch {
+		case from == to && to == len(dia.elemenets)-1:
+			rightMargin = width + 5
+		case from == to:
+			spans = append(spans, span{from, to + 1, width + 6})
+		case from < to:
+			spans = append(spans, span{from, to, width + 3})
+		default:
+			spans = append(spans, span{to, from, width + 3})
+		}
+	}
+	centers := make([]int, len(dia.elemenets))
+	for i := range centers {
+		if i == 0 {
+			centers[i] = boxWidths[i] / 2
+			continue
+		}
+		centers[i] = centers[i-1] + gaps[i]
+		for _, s := range spans {
+			if s.to == i && centers[i]-centers[s.from] < s.width {
+				centers[i] = centers[s.from] + s.width
+			}
+		}
+	}
+	width := 0
+	if n := len(centers); n > 0 {
+		width = centers[n-1] + boxWidths[n-1] - boxWidths[n-1]/2
+		if centers[n-1]+rightMargin+1 > width {
+			width = centers[n-1] + rightMargin + 1
+		}
+	}
+
+	y := 0
+	if dia.title != "" {
+		title := textLines(dia.title)
+		if w := textWidth(title); w > width {
+			width = w
+		}
+		for _, line := range title {
+			grid.write((width-uniseg.StringWidth(line))/2, y, line, nil)
+			y++
+		}
+		y++
+	}
+
+	drawBoxes := func(y int, tee string, top bool) {
+		for i, p := range dia.elemenets {
+			style := mergeStyle(p.Style, Style{Fill: dia.themedParticipantFill(i)})
+			color := textColor(style.Fill)
+			left, right := centers[i]-boxWidths[i]/2, centers[i]-boxWidths[i]/2+boxWidths[i]-1
+			for x := left + 1; x < right; x++ {
+				grid.set(x, y, glyphs.horizontal, color)
+				grid.set(x, y+2, glyphs.horizontal, color)
+			}
+			grid.set(left, y, glyphs.topLeft, color)
+			grid.set(right, y, glyphs.topRight, color)
+			grid.set(left, y+1, glyphs.vertical, color)
+			grid.set(right, y+1, glyphs.vertical, color)
+			grid.set(left, y+2, glyphs.bottomLeft, color)
+			grid.set(right, y+2, glyphs.bottomRight, color)
+			grid.write(left+2, y+1, p.Name, color)
+			if top {
+				grid.set(centers[i], y+2, tee, color)
+			} else {
+				grid.set(centers[i], y, tee, color)
+			}
+		}
+	}
+	if len(dia.elemenets) == 0 {
+		return grid.String(dia.ansiColors)
+	}
+	drawBoxes(y, glyphs.teeDown, true)
+	y += 3
+
+	// lifelines go through every row of messages, which are drawn over them
+	rows := 1
+	for _, e := range dia.edges {
+		lines := len(textLines(e.Label))
+		rows += lines + 2
+		if e.from.Name == e.to.Name && lines == 0 {
+			rows++
+		}
+	}
+	for row := y; row < y+rows; row++ {
+		for _, x := range centers {
+			grid.set(x, row, glyphs.vertical, nil)
+		}
+	}
+
+	y++
+	for _, e := range dia.edges {
+		from, to := centers[index[e.from.Name]], centers[index[e.to.Name]]
+		lineColor := textColor(e.Style.Color)
+		labelColor := textColor(mergeStyle(e.Style, Style{Text: e.Style.Color}).Text)
+		lines := textLines(e.Label)
+
+		if from == to {
+			// a message to oneself loops back, its label beside the loop
+			grid.set(from+1, y, glyphs.horizontal, lineColor)
+			grid.set(from+2, y, glyphs.horizontal, lineColor)
+			grid.set(from+3, y, glyphs.topRight, lineColor)
+			for i, line := range lines {
+				grid.write(from+5, y+i, line, labelColor)
+				if i > 0 {
+					grid.set(from+3, y+i, glyphs.vertical, lineColor)
+				}
+			}
+			bottom := y + len(lines)
+			if len(lines) == 0 {
+				bottom++
+			}
+			if e.directional {
+				grid.set(from+1, bottom, glyphs.arrowLeft, lineColor)
+			} else {
+				grid.set(from+1, bottom, glyphs.horizontal, lineColor)
+			}
+			grid.set(from+2, bottom, glyphs.horizontal, lineColor)
+			grid.set(from+3, bottom, glyphs.bottomRight, lineColor)
+			y = bottom + 2
+			continue
+		}
+
+		// labels sit above the arrow next to the sender, right-aligned on
+		// messages going left
+		for _, line := range lines {
+			if to > from {
+				grid.write(from+2, y, line, labelColor)
+			} else {
+				grid.write(from-1-uniseg.StringWidth(line), y, line, labelColor)
+			}
+			y++
+		}
+		left, right := from, to
+		if to < from {
+			left, right = to, from
+		}
+		for x := left + 1; x < right; x++ {
+			grid.set(x, y, glyphs.horizontal, lineColor)
+		}
+		if e.directional && to > from {
+			grid.set(to-1, y, glyphs.arrowRight, lineColor)
+		} else if e.directional {
+			grid.set(to+1, y, glyphs.arrowLeft, lineColor)
+		}
+		y += 2
+	}
+
+	drawBoxes(y, glyphs.teeUp, false)
+	return grid.String(dia.ansiColors)
+}
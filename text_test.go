@@ -0,0 +1,92 @@
+package zml
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const textSource = "title: Login\nAlice->>Bob: hello **there**\nBob-->>Alice: hi\nBob->>Bob: think\nAlice->>Carol: 日本"
+
+func TestSequenceText(t *testing.T) {
+	want := `
+              Login
+
+┌───────┐      ┌─────┐   ┌───────┐
+│ Alice │      │ Bob │   │ Carol │
+└───┬───┘      └──┬──┘   └───┬───┘
+    │             │          │
+    │ hello there │          │
+    │────────────▶│          │
+    │             │          │
+    │          hi │          │
+    │◀────────────│          │
+    │             │          │
+    │             │──┐ think │
+    │             │◀─┘       │
+    │             │          │
+    │ 日本        │          │
+    │───────────────────────▶│
+    │             │          │
+┌───┴───┐      ┌──┴──┐   ┌───┴───┐
+│ Alice │      │ Bob │   │ Carol │
+└───────┘      └─────┘   └───────┘
+`[1:]
+	dia := NewDiagram("test")
+	dia.ProcessData([]byte(textSource))
+	if got := dia.sequenceText(); got != want {
+		t.Errorf("sequenceText() =\n%s\nwant\n%s", got, want)
+	}
+
+	dia.SetASCII(true)
+	got := dia.sequenceText()
+	for _, r := range strings.ReplaceAll(got, "日本", "") {
+		if r > 127 {
+			t.Fatalf("ASCII text has %q:\n%s", r, got)
+		}
+	}
+	if !strings.Contains(got, "|------------>|") || !strings.Contains(got, "|<------------|") || !strings.Contains(got, "|--+ think |") {
+		t.Errorf("ASCII text doesn't draw the messages:\n%s", got)
+	}
+}
+
+func TestTextGrid(t *testing.T) {
+	g := &textGrid{}
+	red := Color{255, 0, 0, 255}
+	// a wide character takes two columns, trailing spaces are trimmed
+	g.write(0, 0, "a日b", nil)
+	g.set(1, 1, "x", &red)
+	g.set(4, 1, " ", nil)
+	if got, want := g.String(false), "a日b\n x\n"; got != want {
+		t.Errorf("String(false) = %q, want %q", got, want)
+	}
+	if got, want := g.String(true), "a日b\n \x1b[38;2;255;0;0mx\x1b[0m\n"; got != want {
+		t.Errorf("String(true) = %q, want %q", got, want)
+	}
+	if c := textColor(Color{}); c != nil {
+		t.Errorf("textColor of transparent = %v, want nil", c)
+	}
+}
+
+func TestRenderText(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "login.zml")
+	dia := NewDiagram(base)
+	if err := dia.SetFormat(TXT); err != nil {
+		t.Fatal(err)
+	}
+	dia.ProcessData([]byte(textSource))
+	dia.Render(1024, 1024, "")
+	data, err := os.ReadFile(base + ".txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != dia.sequenceText() {
+		t.Errorf("the text file differs from sequenceText():\n%s", data)
+	}
+
+	dia.SetKind(TREE)
+	if err := dia.CheckFormat(); err == nil {
+		t.Errorf("text output of a tree isn't refused")
+	}
+}
@@ -0,0 +1,288 @@
+package zml
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Theme holds the colors and fonts a diagram is drawn with. The text colors
+// are the Color of each font: TitleFont for the title, ElementFont for
+// participant and node names and LabelFont for connection labels.
+type Theme struct {
+	Name              string `json:"name" yaml:"name"`
+	Background        Color  `json:"background" yaml:"background"`
+	ParticipantFill   Color  `json:"participantFill" yaml:"participantFill"`
+	ParticipantStroke Color  `json:"participantStroke" yaml:"participantStroke"`
+	Lifeline          Color  `json:"lifeline" yaml:"lifeline"`
+	Arrow             Color  `json:"arrow" yaml:"arrow"`
+	// Note fills the patches behind connection labels
+	Note Color `json:"note" yaml:"note"`
+	// Fragment and FragmentStroke draw grouping regions: boundaries, subgraphs
+	Fragment       Color `json:"fragment" yaml:"fragment"`
+	FragmentStroke Color `json:"fragmentStroke" yaml:"fragmentStroke"`
+	TitleFont      Font  `json:"titleFont" yaml:"titleFont"`
+	LabelFont      Font  `json:"labelFont" yaml:"labelFont"`
+	ElementFont    Font  `json:"elementFont" yaml:"elementFont"`
+}
+
+// namedColor returns the Color for a literal known to parse, such as the
+// colors of the built-in themes
+func namedColor(s string) Color {
+	c, err := ParseColor(s)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// UnmarshalText reads a color in any notation ParseColor understands, so
+// theme files can use "#ff5050" or "platered"
+func (c *Color) UnmarshalText(text []byte) error {
+	parsed, err := ParseColor(string(text))
+	if err != nil {
+		return err
+	}
+	*c = parsed
+	return nil
+}
+
+// builtinThemes are selectable by name with BuiltinTheme or `--theme`
+var builtinThemes = map[string]Theme{
+	"default": {
+		Name:              "default",
+		Background:        namedColor("white"),
+		ParticipantFill:   namedColor("platered"),
+		ParticipantStroke: namedColor("platered"),
+		Lifeline:          namedColor("black"),
+		Arrow:             namedColor("black"),
+		Note:              namedColor("white"),
+		Fragment:          namedColor("whitesmoke"),
+		FragmentStroke:    namedColor("gray"),
+		TitleFont:         Font{Size: 30, Color: namedColor("black")},
+		LabelFont:         Font{Size: 15, Color: namedColor("black")},
+		ElementFont:       Font{Size: 15, Color: namedColor("white")},
+	},
+	"dark": {
+		Name:              "dark",
+		Background:        namedColor("#1e1e1e"),
+		ParticipantFill:   namedColor("#3b4252"),
+		ParticipantStroke: namedColor("#88c0d0"),
+		Lifeline:          namedColor("#9a9a9a"),
+		Arrow:             namedColor("#d8dee9"),
+		Note:              namedColor("#1e1e1e"),
+		Fragment:          namedColor("#2a2d33"),
+		FragmentStroke:    namedColor("#8b93a1"),
+		TitleFont:         Font{Size: 30, Color: namedColor("#eceff4")},
+		LabelFont:         Font{Size: 15, Color: namedColor("#d8dee9")},
+		ElementFont:       Font{Size: 15, Color: namedColor("#eceff4")},
+	},
+	"monochrome": {
+		Name:              "monochrome",
+		Background:        namedColor("white"),
+		ParticipantFill:   namedColor("gainsboro"),
+		ParticipantStroke: namedColor("dimgray"),
+		Lifeline:          namedColor("gray"),
+		Arrow:             namedColor("black"),
+		Note:              namedColor("white"),
+		Fragment:          namedColor("whitesmoke"),
+		FragmentStroke:    namedColor("gray"),
+		TitleFont:         Font{Size: 30, Color: namedColor("black")},
+		LabelFont:         Font{Size: 15, Color: namedColor("black")},
+		ElementFont:       Font{Size: 15, Color: namedColor("black")},
+	},
+	"high-contrast": {
+		Name:              "high-contrast",
+		Background:        namedColor("black"),
+		ParticipantFill:   namedColor("black"),
+		ParticipantStroke: namedColor("yellow"),
+		Lifeline:          namedColor("white"),
+		Arrow:             namedColor("white"),
+		Note:              namedColor("black"),
+		Fragment:          namedColor("black"),
+		FragmentStroke:    namedColor("cyan"),
+		TitleFont:         Font{Size: 30, Color: namedColor("white")},
+		LabelFont:         Font{Size: 15, Color: namedColor("white")},
+		ElementFont:       Font{Size: 15, Color: namedColor("yellow")},
+	},
+	"print": {
+		Name:              "print",
+		Background:        namedColor("white"),
+		ParticipantFill:   namedColor("white"),
+		ParticipantStroke: namedColor("black"),
+		Lifeline:          namedColor("black"),
+		Arrow:             namedColor("black"),
+		Note:              namedColor("white"),
+		Fragment:          namedColor("white"),
+		FragmentStroke:    namedColor("black"),
+		TitleFont:         Font{Size: 30, Color: namedColor("black")},
+		LabelFont:         Font{Size: 15, Color: namedColor("black")},
+		ElementFont:       Font{Size: 15, Color: namedColor("black")},
+	},
+}
+
+// ThemeNames returns the names of the built-in themes
+func ThemeNames() []string {
+	names := make([]string, 0, len(builtinThemes))
+	for name := range builtinThemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// BuiltinTheme returns the built-in theme called `name`
+func BuiltinTheme(name string) (Theme, error) {
+	theme, ok := builtinThemes[name]
+	if !ok {
+		return Theme{}, fmt.Errorf("unknown theme \"%s\", expected one of %s", name, strings.Join(ThemeNames(), ", "))
+	}
+	return theme, nil
+}
+
+// LoadTheme reads a theme from a JSON or YAML file. Settings missing from the
+// file keep their value from the default theme.
+func LoadTheme(path string) (Theme, error) {
+	theme := builtinThemes["default"]
+	theme.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Theme{}, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, &theme)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &theme)
+	default:
+		return Theme{}, fmt.Errorf("%s: theme files must be .json, .yaml or .yml", path)
+	}
+	if err != nil {
+		return Theme{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return theme, nil
+}
+
+// SetTheme sets the colors and fonts to draw with
+func (dia *Diagram) SetTheme(theme Theme) {
+	dia.theme = theme
+	if dia.debug {
+		log.Printf("theme: %s", dia.theme.Name)
+	}
+}
+
+// setColor makes `c` the current drawing color
+func (dia *Diagram) setColor(c Color) {
+	dia.dc.SetColor(c)
+}
+
+// mergeFont returns `f` with anything it leaves unset taken from the theme's
+// `fallback`: the family and style when Name is empty, the size when zero,
+// the color when it is the zero Color and the fallback fonts when none
+func mergeFont(f, fallback Font) Font {
+	if f.Name == "" {
+		f.Name = fallback.Name
+		if f.Style == "" {
+			f.Style = fallback.Style
+		}
+	}
+	if f.Size == 0 {
+		f.Size = fallback.Size
+	}
+	if len(f.Fallback) == 0 {
+		f.Fallback = fallback.Fallback
+	}
+	if f.Color == (Color{}) {
+		f.Color = fallback.Color
+	}
+	return f
+}
+
+func (dia *Diagram) themedTitleFont() Font {
+	return mergeFont(dia.titleFont, dia.theme.TitleFont)
+}
+
+func (dia *Diagram) themedLabelFont() Font {
+	return mergeFont(dia.labelFont, dia.theme.LabelFont)
+}
+
+func (dia *Diagram) themedElementFont() Font {
+	return mergeFont(dia.elementLabelFont, dia.theme.ElementFont)
+}
+
+// SetAutoColors gives each participant without a fill of its own a color
+// of its own, from Palette, instead of the theme's participant fill
+func (dia *Diagram) SetAutoColors(autoColors bool) {
+	dia.autoColors = autoColors
+}
+
+// themedParticipantFill returns the fill of the participant at `index`
+// unless its style sets one
+func (dia *Diagram) themedParticipantFill(index int) Color {
+	if dia.autoColors {
+		return Palette(len(dia.elemenets))[index]
+	}
+	return dia.theme.ParticipantFill
+}
+
+const (
+	// LIGHT renders with the theme as it is
+	LIGHT = "light"
+	// DARK renders with the dark variant of the theme
+	DARK = "dark"
+	// LIGHTDARK renders both, to <file>-light.png and <file>-dark.png
+	LIGHTDARK = "light-dark"
+)
+
+// SetColorScheme picks LIGHT, DARK or LIGHTDARK output
+func (dia *Diagram) SetColorScheme(scheme string) {
+	switch scheme {
+	case LIGHT, DARK, LIGHTDARK:
+		dia.colorScheme = scheme
+	default:
+		log.Printf("unknown color scheme \"%s\", expected %s, %s or %s", scheme, LIGHT, DARK, LIGHTDARK)
+	}
+}
+
+// invertLightness mirrors the lightness of `c` while keeping its hue,
+// saturation and alpha. White maps to a near black and black to a light
+// gray rather than the extremes, which are harsh on a screen.
+func invertLightness(c Color) Color {
+	if c == (Color{}) {
+		return c
+	}
+	h, s, l := c.HSL()
+	inverted := ColorFromHSL(h, s, 95-0.85*l)
+	inverted.Alpha = c.Alpha
+	return inverted
+}
+
+// Dark returns a dark variant of `theme` with the lightness of every color
+// inverted: a white background turns near black, black lines and text turn
+// white and pale fills turn deep. Element text keeps its color when that
+// reads better on the new fill. Themes with a dark background already are
+// returned as they are.
+func (theme Theme) Dark() Theme {
+	if theme.Background.Luminance() < 0.2 {
+		return theme
+	}
+	dark := theme
+	dark.Name = theme.Name + "-dark"
+	for _, c := range []*Color{
+		&dark.Background, &dark.ParticipantFill, &dark.ParticipantStroke, &dark.Lifeline,
+		&dark.Arrow, &dark.Note, &dark.Fragment, &dark.FragmentStroke,
+		&dark.TitleFont.Color, &dark.LabelFont.Color,
+	} {
+		*c = invertLightness(*c)
+	}
+	if inverted := invertLightness(theme.ElementFont.Color); inverted.ContrastRatio(dark.ParticipantFill) > theme.ElementFont.Color.ContrastRatio(dark.ParticipantFill) {
+		dark.ElementFont.Color = inverted
+	}
+	return dark
+}
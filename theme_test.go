@@ -0,0 +1,88 @@
+package zml
+
+import (
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestInvertLightness(t *testing.T) {
+	for _, c := range []Color{
+		{255, 255, 255, 255}, {0, 0, 0, 255}, {255, 228, 225, 255}, {70, 130, 180, 128}, {25, 25, 112, 255},
+	} {
+		inverted := invertLightness(c)
+		h, s, l := c.HSL()
+		ih, is, il := inverted.HSL()
+		if inverted.Alpha != c.Alpha {
+			t.Errorf("invertLightness(%v) = %v changed the alpha", c, inverted)
+		}
+		if s > 0 && (math.Abs(ih-h) > 2 || math.Abs(is-s) > 2) {
+			t.Errorf("invertLightness(%v) = %v moved the hue or saturation", c, inverted)
+		}
+		if (l > 50) == (il > 50) {
+			t.Errorf("invertLightness(%v) = %v, lightness %.0f to %.0f", c, inverted, l, il)
+		}
+		if il < 5 || il > 95 {
+			t.Errorf("invertLightness(%v) = %v is harsh, lightness %.0f", c, inverted, il)
+		}
+	}
+	if c := invertLightness(Color{}); c != (Color{}) {
+		t.Errorf("transparent inverted to %v", c)
+	}
+}
+
+func TestThemeDark(t *testing.T) {
+	for _, name := range ThemeNames() {
+		theme, _ := BuiltinTheme(name)
+		dark := theme.Dark()
+		if theme.Background.Luminance() < 0.2 {
+			if !reflect.DeepEqual(dark, theme) {
+				t.Errorf("%s is dark already but Dark() changed it", name)
+			}
+			continue
+		}
+		if dark.Name != name+"-dark" {
+			t.Errorf("%s: Dark() named %q", name, dark.Name)
+		}
+		if dark.Background.Luminance() >= 0.2 {
+			t.Errorf("%s: dark background %v isn't dark", name, dark.Background)
+		}
+		for what, pair := range map[string][2]Color{
+			"title":    {dark.TitleFont.Color, dark.Background},
+			"labels":   {dark.LabelFont.Color, dark.Background},
+			"arrows":   {dark.Arrow, dark.Background},
+			"elements": {dark.ElementFont.Color, dark.ParticipantFill},
+		} {
+			if ratio := pair[0].ContrastRatio(pair[1]); ratio < 3 {
+				t.Errorf("%s: dark %s %v on %v have a contrast of %.1f", name, what, pair[0], pair[1], ratio)
+			}
+		}
+	}
+}
+
+func TestRenderLightDark(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "flow.zml")
+	dia := NewDiagram(base)
+	dia.SetColorScheme(LIGHTDARK)
+	dia.ProcessData([]byte("A->>B: hi"))
+	dia.Render(300, 200, "")
+	for suffix, wantDark := range map[string]bool{"-light": false, "-dark": true} {
+		f, err := os.Open(base + suffix + ".png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := png.Decode(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, g, b, _ := img.At(1, 1).RGBA()
+		corner := Color{int(r >> 8), int(g >> 8), int(b >> 8), 255}
+		if dark := corner.Luminance() < 0.2; dark != wantDark {
+			t.Errorf("%s background is %v", suffix, corner)
+		}
+	}
+}
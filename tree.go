@@ -0,0 +1,234 @@
+package zml
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	treeLevelSpacing   = verticalSpaceBetweenEdges
+	treeSiblingSpacing = nodeSpacing / 2
+)
+
+// AddTreeNode adds `id` below `parent` in a tree diagram, or at the top level
+// when `parent` is empty. Adding a node that already exists moves it, with
+// its subtree, under `parent`.
+func (dia *Diagram) AddTreeNode(id, label, parent string) error {
+	parentNode := dia.root
+	if parent != "" {
+		if _, ok := dia.nodes[parent]; !ok {
+			if err := dia.AddTreeNode(parent, parent, ""); err != nil {
+				return err
+			}
+		}
+		parentNode = dia.nodes[parent]
+	}
+	n, ok := dia.nodes[id]
+	if !ok {
+		if label == "" {
+			label = id
+		}
+		n = &node{ID: id, Label: label, Type: RECT}
+		dia.nodes[id] = n
+	} else {
+		for p := parentNode; p != nil; p = p.parent {
+			if p == n {
+				return fmt.Errorf("\"%s\" can't be a child of its own descendant \"%s\"", id, parent)
+			}
+		}
+		siblings := n.parent.children
+		for i := range siblings {
+			if siblings[i] == n {
+				n.parent.children = append(siblings[:i:i], siblings[i+1:]...)
+				break
+			}
+		}
+	}
+	n.parent = parentNode
+	parentNode.children = append(parentNode.children, n)
+	if dia.debug {
+		log.Printf("AddTreeNode(): {id: %s, label: %s, parent: %s}\n", id, n.Label, parent)
+	}
+	return nil
+}
+
+// processTree parses the body of a tree diagram, given either as `parent -> child`
+// lines or as an indented outline:
+//
+//	CTO
+//	    Platform
+//	        SRE
+//	    Product
+func (dia *Diagram) processTree(lines []string) {
+	// an arrow between spaces always makes an edge, one between bare names
+	// only on lines that aren't indented, where it could be an outline label
+	spacedEdgeRegexp := regexp.MustCompile(`^(.+?)\s+-+>{1,2}\s+(.+)$`)
+	edgeRegexp := regexp.MustCompile(`^([\w.]+(?:-[\w.]+)*)-+>{1,2}([\w.]+(?:-[\w.]+)*)$`)
+	type level struct {
+		indent int
+		id     string
+	}
+	var stack []level
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "//") {
+			continue
+		}
+		parts := spacedEdgeRegexp.FindStringSubmatch(trimmed)
+		if parts == nil && trimmed == line {
+			parts = edgeRegexp.FindStringSubmatch(trimmed)
+		}
+		if parts != nil {
+			if err := dia.AddTreeNode(strings.TrimSpace(parts[2]), "", strings.TrimSpace(parts[1])); err != nil {
+				log.Printf(err.Error())
+			}
+			continue
+		}
+
+		indent := len(strings.ReplaceAll(line, "\t", "    ")) - len(strings.TrimLeft(strings.ReplaceAll(line, "\t", "    "), " "))
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		parent := ""
+		if len(stack) > 0 {
+			parent = stack[len(stack)-1].id
+		}
+		// outline labels may repeat (e.g. a README in every directory), the
+		// line number keeps ids unique
+		id := strconv.Itoa(i)
+		label := strings.TrimLeft(trimmed, "-* ")
+		if err := dia.AddTreeNode(id, label, parent); err != nil {
+			log.Printf(err.Error())
+			continue
+		}
+		stack = append(stack, level{indent, id})
+	}
+}
+
+// tidyTree lays out the subtree of `n` following Reingold-Tilford: subtrees
+// are pushed apart just enough for their contours not to overlap at any
+// depth and each parent is centered above its first and last child. Child
+// x values are set to their center offset from the parent's center and the
+// left and right contours of the subtree, per depth, are returned relative
+// to the center of `n`.
+func tidyTree(n *node) ([]float64, []float64) {
+	left, right := []float64{-n.w / 2}, []float64{n.w / 2}
+	if len(n.children) == 0 {
+		return left, right
+	}
+
+	var accLeft, accRight []float64
+	for i, c := range n.children {
+		childLeft, childRight := tidyTree(c)
+		shift := 0.0
+		if i > 0 {
+			shift = math.Inf(-1)
+			for d := 0; d < len(childLeft) && d < len(accRight); d++ {
+				shift = math.Max(shift, accRight[d]-childLeft[d]+treeSiblingSpacing)
+			}
+		}
+		c.x = shift
+		for d := range childLeft {
+			if d < len(accLeft) {
+				accLeft[d] = math.Min(accLeft[d], childLeft[d]+shift)
+				accRight[d] = math.Max(accRight[d], childRight[d]+shift)
+			} else {
+				accLeft = append(accLeft, childLeft[d]+shift)
+				accRight = append(accRight, childRight[d]+shift)
+			}
+		}
+	}
+
+	mid := (n.children[0].x + n.children[len(n.children)-1].x) / 2
+	for _, c := range n.children {
+		c.x -= mid
+	}
+	for d := range accLeft {
+		left = append(left, accLeft[d]-mid)
+		right = append(right, accRight[d]-mid)
+	}
+	return left, right
+}
+
+// placeTree turns the relative offsets from tidyTree into canvas coordinates
+func placeTree(n *node, centerX, y float64) {
+	n.x, n.y = centerX-n.w/2, y
+	for _, c := range n.children {
+		placeTree(c, centerX+c.x, y+n.h+treeLevelSpacing)
+	}
+}
+
+func (dia *Diagram) layoutTree() (float64, float64) {
+	top := dia.top()
+	// all boxes are as tall as the one with the most label lines
+	dia.useFont(dia.themedElementFont())
+	_, lineHeight := dia.measureRuns(nil)
+	boxHeight := elemenetBoxHeight
+	var measureNodes, sizeNodes func(n *node)
+	measureNodes = func(n *node) {
+		_, strHeight := dia.measureLines(dia.boxLines(n.Label, false, elemenetBoxWidth))
+		boxHeight = math.Max(boxHeight, elemenetBoxHeight+strHeight-lineHeight)
+		for _, c := range n.children {
+			measureNodes(c)
+		}
+	}
+	sizeNodes = func(n *node) {
+		n.w, n.h = elemenetBoxWidth, boxHeight
+		for _, c := range n.children {
+			sizeNodes(c)
+		}
+	}
+	for _, c := range dia.root.children {
+		measureNodes(c)
+		sizeNodes(c)
+	}
+
+	// the root is a zero sized virtual parent so a forest lays out like a tree
+	dia.root.w, dia.root.h = 0, 0
+	left, right := tidyTree(dia.root)
+	minX, maxX := 0.0, 0.0
+	for d := range left {
+		minX = math.Min(minX, left[d])
+		maxX = math.Max(maxX, right[d])
+	}
+	treeWidth := maxX - minX
+	marginX := math.Max(elemenetsPadding, (float64(dia.dc.Width())-treeWidth)/2)
+	placeTree(dia.root, marginX-minX, top-treeLevelSpacing)
+
+	treeHeight := float64(len(left)-1) * (boxHeight + treeLevelSpacing)
+	return treeWidth + 2*marginX, top + treeHeight + elemenetsPadding
+}
+
+func (dia *Diagram) renderTree() {
+	dia.renderTreeNode(dia.root)
+}
+
+// renderTreeNode draws the orthogonal connectors from `n` to its children,
+// then the boxes of the subtree
+func (dia *Diagram) renderTreeNode(n *node) {
+	if len(n.children) > 0 && n != dia.root {
+		dia.setColor(dia.theme.Arrow)
+		dia.dc.SetLineWidth(lineStrokeWidth)
+		centerX := n.x + n.w/2
+		midY := n.y + n.h + treeLevelSpacing/2
+		first, last := n.children[0], n.children[len(n.children)-1]
+		dia.dc.DrawLine(centerX, n.y+n.h, centerX, midY)
+		dia.dc.DrawLine(math.Min(centerX, first.x+first.w/2), midY, math.Max(centerX, last.x+last.w/2), midY)
+		for _, c := range n.children {
+			dia.dc.DrawLine(c.x+c.w/2, midY, c.x+c.w/2, c.y)
+		}
+		dia.dc.Stroke()
+	}
+	if n != dia.root {
+		font := dia.themedElementFont()
+		dia.useFont(font)
+		dia.drawNode(n.y+n.h, n.x, n.y, n.x+n.w, dia.theme.ParticipantFill, font.Color, n.Label)
+	}
+	for _, c := range n.children {
+		dia.renderTreeNode(c)
+	}
+}
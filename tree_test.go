@@ -0,0 +1,155 @@
+package zml
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// buildTree adds the "parent>child" `edges` to a new tree diagram, sizing
+// nodes named "wide..." three times as wide as the others
+func buildTree(t *testing.T, edges ...string) *Diagram {
+	dia := NewDiagram("test")
+	dia.SetKind(TREE)
+	for _, e := range edges {
+		parent, child, _ := strings.Cut(e, ">")
+		if err := dia.AddTreeNode(child, "", parent); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, n := range dia.nodes {
+		n.w, n.h = elemenetBoxWidth, elemenetBoxHeight
+		if strings.HasPrefix(n.ID, "wide") {
+			n.w *= 3
+		}
+	}
+	return dia
+}
+
+func TestTidyTree(t *testing.T) {
+	tests := []struct {
+		name  string
+		edges []string
+	}{
+		{"chain", []string{">a", "a>b", "b>c"}},
+		{"fan out", []string{">a", "a>b", "a>c", "a>d", "a>e"}},
+		{"forest", []string{">a", "a>b", ">c", "c>d", "c>e"}},
+		{"wide nodes", []string{">a", "a>wide1", "a>b", "a>wide2", "b>c"}},
+		// the grandchildren of b and c would collide if b and c were only
+		// as far apart as their own boxes need
+		{"deep contours", []string{">a", "a>b", "a>x", "a>c", "b>b1", "b>b2", "b>b3", "c>c1", "c>c2", "c>c3", "b3>b4", "c1>c4"}},
+	}
+	for _, tt := range tests {
+		dia := buildTree(t, tt.edges...)
+		dia.root.w, dia.root.h = 0, 0
+		tidyTree(dia.root)
+		placeTree(dia.root, 500, 0)
+
+		// nodes at the same depth, left to right, keep the sibling spacing
+		for level := dia.root.children; len(level) > 0; {
+			var next []*node
+			for i, n := range level {
+				if i > 0 {
+					prev := level[i-1]
+					if gap := n.x - (prev.x + prev.w); gap < treeSiblingSpacing-1e-9 {
+						t.Errorf("%s: %s and %s are %g apart, want at least %g", tt.name, prev.ID, n.ID, gap, treeSiblingSpacing)
+					}
+				}
+				next = append(next, n.children...)
+			}
+			level = next
+		}
+
+		// parents are centered above their first and last child, a level up
+		for id, n := range dia.nodes {
+			if len(n.children) == 0 {
+				continue
+			}
+			first, last := n.children[0], n.children[len(n.children)-1]
+			mid := (first.x + first.w/2 + last.x + last.w/2) / 2
+			if center := n.x + n.w/2; math.Abs(center-mid) > 1e-9 {
+				t.Errorf("%s: %s is centered at %g, its children at %g", tt.name, id, center, mid)
+			}
+			for _, c := range n.children {
+				if want := n.y + n.h + treeLevelSpacing; c.y != want {
+					t.Errorf("%s: %s is at y %g, want %g below %s", tt.name, c.ID, c.y, want, id)
+				}
+			}
+		}
+	}
+}
+
+func TestAddTreeNode(t *testing.T) {
+	// a node that is added again moves under its new parent with its subtree
+	dia := buildTree(t, "ceo>cto", "ceo>cfo", "cto>sre", "sre>oncall")
+	if err := dia.AddTreeNode("sre", "", "cfo"); err != nil {
+		t.Fatal(err)
+	}
+	for id, want := range map[string][]string{
+		"ceo": {"cto", "cfo"},
+		"cto": nil,
+		"cfo": {"sre"},
+		"sre": {"oncall"},
+	} {
+		if got := childIDs(dia.nodes[id]); !reflect.DeepEqual(got, want) {
+			t.Errorf("children of %s = %q, want %q", id, got, want)
+		}
+	}
+	if got := childIDs(dia.root); !reflect.DeepEqual(got, []string{"ceo"}) {
+		t.Errorf("top level = %q, want [ceo]", got)
+	}
+
+	// a node can't move below itself, the tree is left as it was
+	for _, parent := range []string{"sre", "oncall"} {
+		if err := dia.AddTreeNode("sre", "", parent); err == nil {
+			t.Errorf("moving sre below %s: no error", parent)
+		}
+	}
+	if dia.nodes["sre"].parent != dia.nodes["cfo"] || !reflect.DeepEqual(childIDs(dia.nodes["sre"]), []string{"oncall"}) {
+		t.Errorf("a rejected move changed the tree")
+	}
+}
+
+func TestProcessTree(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want map[string]string
+	}{
+		{
+			name: "edges",
+			in: `CTO -> Platform
+CTO --> Payments
+Platform->>SRE
+api-gw->auth`,
+			want: map[string]string{"CTO": "", "Platform": "CTO", "Payments": "CTO", "SRE": "Platform", "auth": "api-gw", "api-gw": ""},
+		},
+		{
+			// indented lines are outline labels, even with an arrow between
+			// bare names
+			name: "outline",
+			in: `CTO
+    Platform
+        SRE
+        a->b
+    - Payments`,
+			want: map[string]string{"CTO": "", "Platform": "CTO", "SRE": "Platform", "a->b": "Platform", "Payments": "CTO"},
+		},
+	}
+	for _, tt := range tests {
+		dia := NewDiagram("test")
+		dia.ProcessData([]byte("type: tree\n" + tt.in))
+		got := map[string]string{}
+		for _, n := range dia.nodes {
+			parent := ""
+			if n.parent != dia.root {
+				parent = n.parent.Label
+			}
+			got[n.Label] = parent
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: parents = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package zml
+
+import (
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/rivo/uniseg"
+)
+
+const (
+	// DefaultMaxLabelWidth is the width labels wrap at when nothing narrower
+	// holds them
+	DefaultMaxLabelWidth = 300.0
+
+	// lineSpacing is the distance between the baselines of a label's lines,
+	// in font heights
+	lineSpacing = 1.2
+
+	// labelPadding is the space kept between a box and its label on either side
+	labelPadding = 10.0
+)
+
+var lineBreakRegexp = regexp.MustCompile(`(?i)\\n|\n|<br\s*/?>`)
+
+// SetMaxLabelWidth sets the width labels wrap at; 0 only wraps labels that
+// would overflow their box or message
+func (dia *Diagram) SetMaxLabelWidth(width float64) {
+	dia.maxLabelWidth = width
+}
+
+// labelWidth returns the width to wrap a label at when `space` is available
+// for it, 0 or less meaning as much as it needs
+func (dia *Diagram) labelWidth(space float64) float64 {
+	if space <= 0 || dia.maxLabelWidth > 0 && dia.maxLabelWidth < space {
+		return dia.maxLabelWidth
+	}
+	return space
+}
+
+// labelLines splits a label at its explicit line breaks, `\n` or `<br>`,
+// and parses the markup of each line
+func labelLines(s string) [][]textRun {
+	var lines [][]textRun
+	for _, line := range lineBreakRegexp.Split(s, -1) {
+		lines = append(lines, parseRichText(line))
+	}
+	return lines
+}
+
+// lineBreaks returns the byte offsets in `s` where a line may be broken,
+// following the Unicode line breaking algorithm (UAX #14): after spaces and
+// hyphens, between CJK ideographs, but not before closing punctuation such
+// as "。" or "）" nor inside numbers
+func lineBreaks(s string) []int {
+	var breaks []int
+	state, offset := -1, 0
+	for len(s) > 0 {
+		var segment string
+		segment, s, _, state = uniseg.FirstLineSegmentInString(s, state)
+		offset += len(segment)
+		if len(s) > 0 {
+			breaks = append(breaks, offset)
+		}
+	}
+	return breaks
+}
+
+// splitRuns cuts `runs` at the byte offsets `at` of their plain text
+func splitRuns(runs []textRun, at []int) [][]textRun {
+	var words [][]textRun
+	var word []textRun
+	offset := 0
+	for _, run := range runs {
+		text := run.text
+		for len(at) > 0 && at[0] < offset+len(text) {
+			piece := run
+			piece.text = text[:at[0]-offset]
+			if piece.text != "" {
+				word = append(word, piece)
+			}
+			words = append(words, word)
+			word = nil
+			text = text[at[0]-offset:]
+			offset = at[0]
+			at = at[1:]
+		}
+		if text != "" {
+			piece := run
+			piece.text = text
+			word = append(word, piece)
+		}
+		offset += len(text)
+	}
+	if len(word) > 0 {
+		words = append(words, word)
+	}
+	return words
+}
+
+// trimRuns returns `runs` without the spaces they end with
+func trimRuns(runs []textRun) []textRun {
+	for len(runs) > 0 {
+		last := runs[len(runs)-1]
+		last.text = strings.TrimRight(last.text, " ")
+		if last.text != "" {
+			trimmed := append([]textRun{}, runs[:len(runs)-1]...)
+			return append(trimmed, last)
+		}
+		runs = runs[:len(runs)-1]
+	}
+	return runs
+}
+
+// wrapRuns breaks a line into lines no wider than `maxWidth`, between words
+// where it can and inside words too wide for a line of their own
+func (dia *Diagram) wrapRuns(runs []textRun, maxWidth float64) [][]textRun {
+	if maxWidth <= 0 {
+		return [][]textRun{runs}
+	}
+	if w, _ := dia.measureRuns(runs); w <= maxWidth {
+		return [][]textRun{runs}
+	}
+
+	var lines [][]textRun
+	var line []textRun
+	lineWidth := 0.0
+	for _, word := range splitRuns(runs, lineBreaks(plainText(runs))) {
+		width, _ := dia.measureRuns(trimRuns(word))
+		if len(line) > 0 && lineWidth+width > maxWidth {
+			lines = append(lines, trimRuns(line))
+			line, lineWidth = nil, 0
+		}
+		if width > maxWidth {
+			pieces := dia.splitWord(word, maxWidth)
+			lines = append(lines, pieces[:len(pieces)-1]...)
+			word = pieces[len(pieces)-1]
+		}
+		line = append(line, word...)
+		fullWidth, _ := dia.measureRuns(word)
+		lineWidth += fullWidth
+	}
+	return append(lines, trimRuns(line))
+}
+
+// splitWord breaks a word too wide for `maxWidth` between its characters,
+// keeping accents, emoji sequences and the like whole
+func (dia *Diagram) splitWord(word []textRun, maxWidth float64) [][]textRun {
+	var pieces [][]textRun
+	var piece []textRun
+	for _, run := range word {
+		start, last, i := 0, 0, 0
+		for rest, state := run.text, -1; len(rest) > 0; {
+			var cluster string
+			cluster, rest, _, state = uniseg.FirstGraphemeClusterInString(rest, state)
+			i += len(cluster)
+			part := run
+			part.text = run.text[start:i]
+			if w, _ := dia.measureRuns(append(piece, part)); w > maxWidth && (len(piece) > 0 || last > start) {
+				// the cluster from `last` on goes on the next line
+				if last > start {
+					part.text = run.text[start:last]
+					piece = append(piece, part)
+				}
+				pieces = append(pieces, piece)
+				piece, start = nil, last
+			}
+			last = i
+		}
+		rest := run
+		rest.text = run.text[start:]
+		piece = append(piece, rest)
+	}
+	return append(pieces, piece)
+}
+
+// wrapLines wraps each of `lines` to `maxWidth`, 0 for no wrapping
+func (dia *Diagram) wrapLines(lines [][]textRun, maxWidth float64) [][]textRun {
+	var wrapped [][]textRun
+	for _, line := range lines {
+		wrapped = append(wrapped, dia.wrapRuns(line, maxWidth)...)
+	}
+	return wrapped
+}
+
+// boxLines returns the lines of `label` wrapped to fit in a box `boxWidth` wide
+func (dia *Diagram) boxLines(label string, bold bool, boxWidth float64) [][]textRun {
+	lines := labelLines(label)
+	if bold {
+		for i := range lines {
+			lines[i] = emboldened(lines[i])
+		}
+	}
+	return dia.wrapLines(lines, dia.labelWidth(boxWidth-2*labelPadding))
+}
+
+// measureLines returns the width of the widest of `lines` and the height
+// they take one below the other
+func (dia *Diagram) measureLines(lines [][]textRun) (float64, float64) {
+	width, lineHeight := 0.0, 0.0
+	for _, line := range lines {
+		w, h := dia.measureRuns(line)
+		width, lineHeight = math.Max(width, w), h
+	}
+	return width, lineHeight + float64(len(lines)-1)*lineHeight*lineSpacing
+}
+
+// drawLines draws `lines` one below the other, each anchored at `x` like
+// drawRuns. Lines anchored by their top (ay = 1) go down from `y`, by their
+// baseline (ay = 0) go up from it and otherwise are centered on it.
+func (dia *Diagram) drawLines(lines [][]textRun, x, y, ax, ay float64) {
+	_, lineHeight := dia.measureRuns(nil)
+	step := lineHeight * lineSpacing
+	extra := float64(len(lines)-1) * step
+	switch {
+	case ay == 0:
+		y -= extra
+	case ay < 1:
+		y -= extra / 2
+	}
+	for i, line := range lines {
+		dia.drawRuns(line, x, y+float64(i)*step, ax, ay)
+	}
+}
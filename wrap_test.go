@@ -0,0 +1,52 @@
+package zml
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLineBreaks(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []int
+	}{
+		{"word", nil},
+		{"hello world", []int{6}},
+		{"a  b", []int{3}},
+		{"well-known", []int{5}},
+		{"x/y", []int{2}},
+		// not inside numbers
+		{"3.14 apples", []int{5}},
+		{"$100", nil},
+		// between ideographs, but not after "（" nor before "）" or "。"
+		{"漢字です", []int{3, 6, 9}},
+		{"これは（漢字）。です", []int{3, 6, 9, 15, 24, 27}},
+	}
+	for _, tt := range tests {
+		if got := lineBreaks(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("lineBreaks(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLabelLines(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"one", []string{"one"}},
+		{`one\ntwo`, []string{"one", "two"}},
+		{"one\ntwo", []string{"one", "two"}},
+		{"one<br>two<BR/>three<br />four", []string{"one", "two", "three", "four"}},
+		{"**bold**<br>*it*", []string{"bold", "it"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, line := range labelLines(tt.in) {
+			got = append(got, plainText(line))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("labelLines(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
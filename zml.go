@@ -2,8 +2,9 @@ package zml
 
 import (
 	"fmt"
-	"image/color"
+	"io"
 	"log"
+	"math"
 	"path/filepath"
 	"regexp"
 	"strings"
@@ -23,20 +24,55 @@ const (
 
 	width  = 1024
 	height = 1000
-	// TODO: expose on Diagram struct instead
-	nodeBgColor    = "platered"
-	nodeLabelColor = "white"
 )
 
+var linkRegexp = regexp.MustCompile(`^([\w.]+(?:-[\w.]+)*)\s*(-+>{0,2})\s*([\w.]+(?:-[\w.]+)*)\s*(?::\s*(.*))?$`)
+
 // Diagram represents a diagram
 type Diagram struct {
 	elemenets         []elemenet
 	edges             []edge
 	renderedElemenets []*elemenet
 	elemenetsCoordMap map[string]elemenetCoord
-
-	dc               *gg.Context
+	// set by the layout: the height of participant boxes or lane headers,
+	// and the pages of a sequence diagram
+	headerHeight float64
+	pages        []sequencePage
+
+	kind       string
+	root       *node
+	nodes      map[string]*node
+	links      []link
+	horizontal bool
+	edgeStyle  string
+
+	minContrast    float64
+	contrastWarned map[[2]Color]bool
+	colorScheme    string
+	fontManager    *FontManager
+	fontWarned     map[string]bool
+	currentFont    Font
+	maxLabelWidth  float64
+	pageWidth      float64
+	pageHeight     float64
+	scale          float64
+	quality        int
+	transparent    bool
+	ascii          bool
+	ansiColors     bool
+	autoColors     bool
+	// set while previewing: the terminal drawn to instead of files
+	preview         io.Writer
+	previewGraphics string
+
+	dc               canvas
+	format           string
+	output           string
+	source           string
 	title            string
+	author           string
+	theme            Theme
+	bgColor          Color
 	filename         string
 	fontDir          string
 	titleFont        Font
@@ -52,43 +88,173 @@ func NewDiagram(filename string) *Diagram {
 	return &Diagram{
 		elemenetsCoordMap: coordMap,
 		filename:          filename,
+		kind:              SEQUENCE,
+		edgeStyle:         ORTHOGONAL,
+		root:              &node{Type: BOUNDARY},
+		nodes:             make(map[string]*node),
+		theme:             builtinThemes["default"],
+		minContrast:       DefaultMinContrast,
+		colorScheme:       LIGHT,
+		fontManager:       DefaultFontManager,
+		maxLabelWidth:     DefaultMaxLabelWidth,
+		format:            PNG,
+		scale:             1,
+		quality:           DefaultQuality,
 	}
 }
 
-// Render generates an image from a `Diagram` object
+// Render generates an image from a `Diagram` object; `color` overrides the
+// theme's background when not empty, "transparent" leaving it unpainted in
+// formats with an alpha channel
 func (dia *Diagram) Render(width, height float64, color string) {
-	dia.dc = gg.NewContext(int(width), int(height))
-	dia.dc.DrawRectangle(0, 0, width, height)
-	dia.dc.SetRGB255(Colorlookup(color))
-	dia.dc.Fill()
+	theme := dia.theme
+	dia.transparent = strings.EqualFold(strings.TrimSpace(color), "transparent")
+	if color != "" && !dia.transparent {
+		if bgColor, err := ParseColor(color); err != nil {
+			log.Printf(err.Error())
+		} else {
+			theme.Background = bgColor
+		}
+	}
+	base, ext := dia.filename, "."+dia.format
+	if dia.output != "" {
+		ext = filepath.Ext(dia.output)
+		base = strings.TrimSuffix(dia.output, ext)
+	}
+	switch dia.colorScheme {
+	case DARK:
+		dia.renderTheme(width, height, theme.Dark(), base+ext)
+	case LIGHTDARK:
+		dia.renderTheme(width, height, theme, base+"-light"+ext)
+		dia.renderTheme(width, height, theme.Dark(), base+"-dark"+ext)
+	default:
+		dia.renderTheme(width, height, theme, base+ext)
+	}
+}
 
-	dia.renderTitle()
-	dia.renderElemenets()
-	dia.renderConnections()
+// renderTheme draws the diagram with `theme` and saves it to
+// `imageOutputFile`; pages after the first go to the same PDF, or to image
+// files numbered from 1
+func (dia *Diagram) renderTheme(width, height float64, theme Theme, imageOutputFile string) {
+	defer func(saved Theme) {
+		dia.theme = saved
+	}(dia.theme)
+	dia.theme = theme
+	if dia.format == TXT {
+		dia.renderText(imageOutputFile)
+		return
+	}
 
-	imageOutputFile := fmt.Sprintf("%s.png", dia.filename)
-	dia.dc.SavePNG(imageOutputFile)
-	if dia.debug {
-		log.Printf("Saved to %s\n", imageOutputFile)
+	// lay out on a scratch context first, the canvas grows to fit unless
+	// the diagram is split into pages
+	if dia.paginated() {
+		width, height = dia.pageWidth, dia.pageHeight
 	}
-}
+	scale := dia.scale
+	if dia.format == PDF {
+		scale = 1
+	}
+	dia.dc = newRasterCanvas(width, height, scale)
+	layoutWidth, layoutHeight := dia.layout()
+	if !dia.paginated() {
+		width = math.Max(width, layoutWidth)
+		height = math.Max(height, layoutHeight)
+	}
+	dia.bgColor = dia.theme.Background
 
-func (dia *Diagram) renderTitle() {
-	s := dia.title
-	if dia.fontDir != "" && dia.titleFont.Name != "" {
-		if err := dia.dc.LoadFontFace(filepath.Join(dia.fontDir, dia.titleFont.Name), dia.titleFont.Size); err != nil {
+	pages := 1
+	if dia.kind == SEQUENCE {
+		pages = len(dia.pages)
+	}
+	for n := 0; n < pages; n++ {
+		if pdf, ok := dia.dc.(*pdfCanvas); ok && n > 0 {
+			pdf.addPage()
+		} else {
+			dia.dc = dia.newCanvas(width, height)
+		}
+		// JPEG has no alpha channel, transparent pixels would turn black
+		if !dia.transparent || dia.format == JPEG {
+			dia.dc.DrawRectangle(0, 0, width, height)
+			dia.setColor(dia.bgColor)
+			dia.dc.Fill()
+		}
+
+		if n == 0 {
+			dia.renderTitle()
+		}
+		switch dia.kind {
+		case ARCHITECTURE:
+			dia.renderArchitecture()
+		case ACTIVITY:
+			dia.renderActivity()
+		case TREE:
+			dia.renderTree()
+		case FLOWCHART:
+			dia.renderFlowchart()
+		default:
+			dia.renderedElemenets = nil
+			dia.renderElemenets(dia.pages[n])
+			dia.renderConnections(dia.pages[n])
+			dia.renderContinuation(n)
+		}
+
+		outputFile := imageOutputFile
+		if _, ok := dia.dc.(*pdfCanvas); ok {
+			if n < pages-1 {
+				continue
+			}
+		} else if pages > 1 {
+			outputFile = pageFile(imageOutputFile, n+1)
+		}
+		if err := dia.save(outputFile); err != nil {
 			log.Printf(err.Error())
+			return
+		}
+		if dia.debug && dia.preview == nil {
+			log.Printf("Saved to %s\n", outputFile)
 		}
 	}
-	textWidth, _ := dia.dc.MeasureString(s)
-	centerX := float64(dia.dc.Width())/2.0 - float64(textWidth)/2.0
-	dia.dc.SetColor(color.Black)
-	dia.dc.DrawString(s, centerX, height*0.05)
+}
+
+// layout positions the participants, messages or nodes of the diagram and
+// returns the canvas size they need
+func (dia *Diagram) layout() (float64, float64) {
+	switch dia.kind {
+	case SEQUENCE:
+		return dia.layoutSequence()
+	case ARCHITECTURE:
+		return dia.layoutArchitecture()
+	case ACTIVITY:
+		return dia.layoutActivity()
+	case TREE:
+		return dia.layoutTree()
+	case FLOWCHART:
+		return dia.layoutFlowchart()
+	}
+	return 0, 0
+}
+
+// top returns the y diagrams start at, below the title and any lines it
+// has beyond the first
+func (dia *Diagram) top() float64 {
+	dia.useFont(dia.themedTitleFont())
+	_, lineHeight := dia.measureRuns(nil)
+	_, titleHeight := dia.measureLines(labelLines(dia.title))
+	return height*0.1 + titleHeight - lineHeight
+}
+
+func (dia *Diagram) renderTitle() {
+	font := dia.themedTitleFont()
+	dia.useFont(font)
+	_, lineHeight := dia.measureRuns(nil)
+	centerX := float64(dia.dc.Width()) / 2.0
+	dia.setColor(dia.readableText(font.Color, dia.bgColor))
+	dia.drawLines(labelLines(dia.title), centerX, height*0.05-lineHeight, 0.5, 1)
 	dia.dc.Stroke()
 }
 
-func (dia *Diagram) drawBorder(color string, rectangleStrokeWidth float64, startX, startY, endX, endY float64) {
-	dia.dc.SetRGB255(Colorlookup(color))
+func (dia *Diagram) drawBorder(color Color, rectangleStrokeWidth float64, startX, startY, endX, endY float64) {
+	dia.setColor(color)
 	dia.dc.SetLineWidth(rectangleStrokeWidth)
 	dia.dc.SetFillRule(gg.FillRuleEvenOdd)
 
@@ -105,57 +271,129 @@ func (dia *Diagram) drawBorder(color string, rectangleStrokeWidth float64, start
 	dia.dc.Stroke()
 }
 
-func (dia *Diagram) drawDecisionNode(startX, startY float64, nodeBgColor, label string) {
-	strWidth, strHeight := dia.dc.MeasureString(label)
-	size := strWidth + 30
-	centerStrWidth := startX - strWidth/2
-	centerStrHeight := (startY + size/2) + (strHeight / 2)
+// decisionSize returns the width and height of the diamond drawDecisionNode
+// draws around `label`
+func (dia *Diagram) decisionSize(label string) float64 {
+	strWidth, strHeight := dia.measureText(label)
+	_, lineHeight := dia.measureRuns(nil)
+	return strWidth + 30 + strHeight - lineHeight
+}
+
+func (dia *Diagram) drawDecisionNode(startX, startY float64, nodeBgColor Color, label string) {
+	size := dia.decisionSize(label)
 	dia.dc.LineTo(startX+size/2, startY+size/2)
 	dia.dc.LineTo(startX, startY+size)
 	dia.dc.LineTo(startX-size/2, startY+size/2)
 	dia.dc.LineTo(startX, startY)
 	dia.dc.LineTo(startX+size/2, startY+size/2)
-	dia.dc.SetRGB255(Colorlookup(nodeBgColor))
+	dia.setColor(nodeBgColor)
 	dia.dc.FillPreserve()
+	dia.setColor(dia.theme.ParticipantStroke)
+	dia.dc.SetLineWidth(lineStrokeWidth)
+	dia.dc.Stroke()
 
-	dia.dc.SetRGB255(Colorlookup(nodeLabelColor))
-	dia.dc.DrawString(
-		label,
-		centerStrWidth,
-		centerStrHeight,
-	)
+	dia.setColor(dia.readableText(dia.themedElementFont().Color, nodeBgColor))
+	dia.drawText(label, startX, startY+size/2, 0.5, 0.5)
 	dia.dc.Stroke()
+}
+
+func (dia *Diagram) drawNode(lineEndY, startX, startY, endX float64, nodeBgColor, nodeLabelColor Color, label string) {
+	dia.drawBox(startX, startY, endX-startX, lineEndY-startY, nodeBgColor, nodeLabelColor, label)
+}
 
-	dia.dc.SetColor(color.Black)
+// drawBox draws a rounded box of any size with `label` centered in it
+func (dia *Diagram) drawBox(startX, startY, boxWidth, boxHeight float64, nodeBgColor, nodeLabelColor Color, label string) {
+	dia.drawStyledBox(startX, startY, boxWidth, boxHeight, Style{Fill: nodeBgColor, Color: dia.theme.ParticipantStroke, Text: nodeLabelColor}, label)
 }
 
-func (dia *Diagram) drawNode(lineEndY, startX, startY, endX float64, nodeBgColor, nodeLabelColor, label string) {
-	endY := startY + elemenetBoxHeight
-	strWidth, strHeight := dia.dc.MeasureString(label)
-	centerStrWidth := startX + ((endX - startX) / 2) - strWidth/2
-	centerStrHeight := (endY-startY)/2 + startY + (strHeight / 2)
-	dia.dc.SetColor(color.Gray{Y: 230})
+// drawStyledBox draws a box like drawBox with the colors of `style`
+func (dia *Diagram) drawStyledBox(startX, startY, boxWidth, boxHeight float64, style Style, label string) {
+	lines := dia.boxLines(label, style.Bold, boxWidth)
 	dia.dc.DrawRoundedRectangle(
 		startX,
 		startY,
-		elemenetBoxWidth,
-		elemenetBoxHeight,
+		boxWidth,
+		boxHeight,
 		5,
 	)
-	dia.dc.SetRGB255(Colorlookup(nodeBgColor))
-	dia.dc.Fill()
-	dia.dc.SetRGB255(Colorlookup(nodeLabelColor))
-
-	dia.dc.DrawString(
-		label,
-		centerStrWidth,
-		centerStrHeight,
-	)
+	dia.setColor(style.Fill)
+	dia.dc.FillPreserve()
+	dia.setColor(style.Color)
+	dia.dc.SetLineWidth(lineStrokeWidth)
+	if style.Bold {
+		dia.dc.SetLineWidth(rectangleStrokeWidth)
+	}
 	dia.dc.Stroke()
-	dia.dc.SetColor(color.Black)
+	dia.setColor(dia.readableText(style.Text, style.Fill))
+
+	dia.drawLines(lines, startX+boxWidth/2, startY+boxHeight/2, 0.5, 0.5)
+	dia.dc.Stroke()
+}
+
+// layoutSequence places the participants, grows their boxes and the message
+// rows to fit labels of several lines, splits the rows into pages when the
+// diagram is paginated and returns the canvas size needed
+func (dia *Diagram) layoutSequence() (float64, float64) {
+	top := dia.top()
+	dia.useFont(dia.themedElementFont())
+	_, lineHeight := dia.measureRuns(nil)
+	dia.headerHeight = elemenetBoxHeight
+	for i, p := range dia.elemenets {
+		spacePerBlock := float64(dia.dc.Width() / len(dia.elemenets))
+		dia.elemenetsCoordMap[p.Name] = elemenetCoord{
+			X: spacePerBlock*float64(i+1) - spacePerBlock/2 - elemenetsPadding,
+			Y: top,
+		}
+		_, strHeight := dia.measureLines(dia.boxLines(p.Name, p.Style.Bold, elemenetBoxWidth))
+		dia.headerHeight = math.Max(dia.headerHeight, elemenetBoxHeight+strHeight-lineHeight)
+	}
+
+	dia.useFont(dia.themedLabelFont())
+	_, lineHeight = dia.measureRuns(nil)
+	// a page ends when the next row would leave no room for the participant
+	// boxes closing the lifelines
+	pageHeight := math.Inf(1)
+	if dia.paginated() {
+		pageHeight = dia.pageHeight
+	}
+	page := sequencePage{top: top}
+	rowY := top + dia.headerHeight + 2.5 + verticalSpaceBetweenEdges
+	dia.pages = dia.pages[:0]
+	for idx := range dia.edges {
+		_, textHeight := dia.measureLines(dia.messageLines(&dia.edges[idx]))
+		rowHeight := verticalSpaceBetweenEdges + textHeight - lineHeight
+		if idx > page.first && rowY+rowHeight+1+dia.headerHeight+elemenetsPadding > pageHeight {
+			page.last = idx
+			page.rows = append(page.rows, rowY)
+			dia.pages = append(dia.pages, page)
+			page = sequencePage{first: idx, top: height * 0.1}
+			rowY = page.top + dia.headerHeight + 2.5 + verticalSpaceBetweenEdges
+		}
+		page.rows = append(page.rows, rowY)
+		rowY += rowHeight
+	}
+	page.last = len(dia.edges)
+	page.rows = append(page.rows, rowY)
+	dia.pages = append(dia.pages, page)
+	return float64(dia.dc.Width()), rowY + 1 + dia.headerHeight + elemenetsPadding
+}
+
+// messageLines returns the label of message `e` wrapped to the space between
+// its participants
+func (dia *Diagram) messageLines(e *edge) [][]textRun {
+	lines := labelLines(e.Label)
+	if e.Style.Bold {
+		for i := range lines {
+			lines[i] = emboldened(lines[i])
+		}
+	}
+	space := math.Abs(dia.elemenetsCoordMap[e.to.Name].X - dia.elemenetsCoordMap[e.from.Name].X)
+	return dia.wrapLines(lines, dia.labelWidth(math.Max(elemenetBoxWidth, space-elemenetsPadding)))
 }
 
-func (dia *Diagram) renderElemenets() {
+// renderElemenets draws the participant boxes and lifelines of `page`, with
+// boxes closing the lifelines on the last page
+func (dia *Diagram) renderElemenets(page sequencePage) {
 	for idx := range dia.elemenets {
 		p := &dia.elemenets[idx]
 
@@ -164,54 +402,58 @@ func (dia *Diagram) renderElemenets() {
 				return
 			}
 		}
-		spacePerBlock := float64(dia.dc.Width() / len(dia.elemenets))
-		startX := spacePerBlock*float64(len(dia.renderedElemenets)+1) - spacePerBlock/2 - elemenetsPadding
+		startX := dia.elemenetsCoordMap[p.Name].X
 		endX := startX + elemenetBoxWidth
-		startY := height * 0.1 // 10% from the top
-		endY := startY + elemenetBoxHeight
+		startY := page.top
+		endY := startY + dia.headerHeight
 		// dia.drawBorder("green", rectangleStrokeWidth, startX, startY, endX, endY)
 
-		if dia.fontDir != "" && dia.elementLabelFont.Name != "" {
-			if err := dia.dc.LoadFontFace(filepath.Join(dia.fontDir, dia.elementLabelFont.Name), dia.elementLabelFont.Size); err != nil {
-				log.Printf(err.Error())
-			}
-		}
+		font := dia.themedElementFont()
+		dia.useFont(font)
+		style := mergeStyle(p.Style, Style{Fill: dia.themedParticipantFill(idx), Color: dia.theme.ParticipantStroke, Text: font.Color})
 
-		dia.drawNode(endY, startX, startY, endX, nodeBgColor, nodeLabelColor, p.Name)
-		dia.elemenetsCoordMap[p.Name] = elemenetCoord{
-			X: startX,
-			Y: startY,
-		}
+		dia.drawStyledBox(startX, startY, endX-startX, dia.headerHeight, style, p.Name)
 
 		// render vertical action line for each elemenet
 		centerX := startX + (endX-startX)/2 - 2.5
 		lineStartY := endY + 2.5
-		lineEndY := float64(len(dia.edges)*(verticalSpaceBetweenEdges)) + lineStartY + verticalSpaceBetweenEdges // padding
+		lineEndY := page.rows[len(page.rows)-1]
 
+		dia.setColor(dia.theme.Lifeline)
 		dia.dc.SetLineWidth(lineStrokeWidth)
 		dia.dc.DrawLine(centerX, lineStartY, centerX, lineEndY)
 		dia.dc.Stroke()
 
-		startY = lineEndY + 1
-		dia.drawNode(lineEndY, startX, startY, endX, nodeBgColor, nodeLabelColor, p.Name)
+		if page.last == len(dia.edges) {
+			startY = lineEndY + 1
+			dia.drawStyledBox(startX, startY, endX-startX, dia.headerHeight, style, p.Name)
+		}
 		dia.renderedElemenets = append(dia.renderedElemenets, p)
 
 		// dia.drawDecisionNode(startX + 50, 300, "green", "A Decision Node")
 	}
 }
 
-func (dia *Diagram) renderConnections() {
-	renderedEdges := 0
-
-	for idx := range dia.edges {
+// renderConnections draws the messages of `page`
+func (dia *Diagram) renderConnections(page sequencePage) {
+	for idx := page.first; idx < page.last; idx++ {
 		e := &dia.edges[idx]
 		fromCords := dia.elemenetsCoordMap[e.from.Name]
 		toCords := dia.elemenetsCoordMap[e.to.Name]
 		startX := fromCords.X + elemenetBoxWidth/2 - 2.5 // 2.5 = half of stroke width
-		startY := fromCords.Y + elemenetBoxHeight + 2.5 + float64((1+renderedEdges)*verticalSpaceBetweenEdges)
+		startY := page.rows[idx-page.first]
 		endX := toCords.X + elemenetBoxWidth/2 - 2.5
 		isReverseEdge := endX < startX
+		font := dia.themedLabelFont()
+		// a styled message colors its label like its line unless told otherwise
+		style := mergeStyle(e.Style, Style{Text: e.Style.Color})
+		style = mergeStyle(style, Style{Color: dia.theme.Arrow, Text: font.Color})
 
+		dia.setColor(style.Color)
+		dia.dc.SetLineWidth(lineStrokeWidth)
+		if style.Bold {
+			dia.dc.SetLineWidth(rectangleStrokeWidth)
+		}
 		dia.dc.SetDash(6)
 		dia.dc.DrawLine(
 			startX,
@@ -237,25 +479,15 @@ func (dia *Diagram) renderConnections() {
 		}
 
 		if e.Label != "" {
-			if dia.fontDir != "" && dia.labelFont.Name != "" {
-				if err := dia.dc.LoadFontFace(filepath.Join(dia.fontDir, dia.labelFont.Name), dia.labelFont.Size); err != nil {
-					log.Printf(err.Error())
-				}
-			}
-			textWidth, textHeight := dia.dc.MeasureString(e.Label)
-			textY := startY + textHeight + 5
-			textX := startX
+			dia.useFont(font)
+			dia.setColor(dia.readableText(style.Text, dia.bgColor))
+			// labels hang below the line, right-aligned on messages going left
 			if isReverseEdge {
-				textX -= elemenetsPadding / 2
-				textX -= textWidth
+				dia.drawLines(dia.messageLines(e), startX-elemenetsPadding/2, startY+5, 1, 1)
 			} else {
-				textX += elemenetsPadding / 2
+				dia.drawLines(dia.messageLines(e), startX+elemenetsPadding/2, startY+5, 0, 1)
 			}
-
-			dia.dc.DrawString(e.Label, textX, textY)
 		}
-
-		renderedEdges++
 	}
 }
 
@@ -331,6 +563,66 @@ func (dia *Diagram) AddConnection(from, to string, label string) error {
 	return nil
 }
 
+// AddNode adds a node to a hierarchical diagram, inside the BOUNDARY node
+// `parent` or at the top level when `parent` is empty
+func (dia *Diagram) AddNode(id, label string, nodeType int, parent string) error {
+	if _, ok := dia.nodes[id]; ok {
+		return fmt.Errorf("node \"%s\" already exists", id)
+	}
+	parentNode := dia.root
+	if parent != "" {
+		var ok bool
+		parentNode, ok = dia.nodes[parent]
+		if !ok {
+			return fmt.Errorf("node \"%s\" not found", parent)
+		}
+		if !parentNode.isGroup() {
+			return fmt.Errorf("node \"%s\" can't contain other nodes", parent)
+		}
+	}
+	if label == "" {
+		label = id
+	}
+	n := &node{ID: id, Label: label, Type: nodeType, parent: parentNode}
+	parentNode.children = append(parentNode.children, n)
+	dia.nodes[id] = n
+	if dia.debug {
+		log.Printf("AddNode(): {id: %s, label: %s, type: %d, parent: %s}\n", id, label, nodeType, parent)
+	}
+	return nil
+}
+
+// AddLink connects two nodes of a hierarchical diagram
+func (dia *Diagram) AddLink(from, to string, label string, directional bool) error {
+	fromNode, ok := dia.nodes[from]
+	if !ok {
+		return fmt.Errorf("node \"%s\" not found", from)
+	}
+	toNode, ok := dia.nodes[to]
+	if !ok {
+		return fmt.Errorf("node \"%s\" not found", to)
+	}
+	if dia.debug {
+		log.Printf("{from: %s, to: %s, Label: %s, directional: %t}\n", from, to, label, directional)
+	}
+	dia.links = append(dia.links, link{from: fromNode, to: toNode, Label: label, directional: directional})
+	return nil
+}
+
+// processLink adds the link described by `line`, e.g. `api ->> bank: charges`,
+// and reports whether the line was a link
+func (dia *Diagram) processLink(line string) bool {
+	parts := linkRegexp.FindStringSubmatch(line)
+	if parts == nil {
+		return false
+	}
+	relationType := parts[2]
+	if err := dia.AddLink(parts[1], parts[3], strings.TrimSpace(parts[4]), relationType[len(relationType)-1] == '>'); err != nil {
+		log.Printf(err.Error())
+	}
+	return true
+}
+
 // SetTitle sets the diagram's title
 func (dia *Diagram) SetTitle(title string) {
 	dia.title = title
@@ -339,6 +631,11 @@ func (dia *Diagram) SetTitle(title string) {
 	}
 }
 
+// SetAuthor sets the author recorded in the metadata of PDF output
+func (dia *Diagram) SetAuthor(author string) {
+	dia.author = author
+}
+
 // SetFontDir path to font dir
 func (dia *Diagram) SetFontDir(dir string) {
 	dia.fontDir = dir
@@ -371,6 +668,23 @@ func (dia *Diagram) SetElementLabelFont(font Font) {
 	}
 }
 
+// SetKind sets the diagram kind (SEQUENCE, ARCHITECTURE, ACTIVITY, TREE,
+// FLOWCHART)
+func (dia *Diagram) SetKind(kind string) {
+	dia.kind = kind
+	if dia.debug {
+		log.Printf("kind: %s", dia.kind)
+	}
+}
+
+// SetEdgeStyle sets how links of graph style diagrams are routed (ORTHOGONAL, SPLINE, STRAIGHT)
+func (dia *Diagram) SetEdgeStyle(style string) {
+	dia.edgeStyle = style
+	if dia.debug {
+		log.Printf("edgeStyle: %s", dia.edgeStyle)
+	}
+}
+
 // SetDebug set debug value
 func (dia *Diagram) SetDebug(debug bool) {
 	dia.debug = debug
@@ -378,9 +692,10 @@ func (dia *Diagram) SetDebug(debug bool) {
 
 // ProcessData generates image from ZML data
 func (dia *Diagram) ProcessData(data []byte) {
+	dia.source = string(data)
 	sliceData := strings.Split(string(data), "\n")
 	firstLine := sliceData[0]
-	titleRegexp := regexp.MustCompile(`^\[?title\]?\s*:\s*([\w\s.,-]+)`)
+	titleRegexp := regexp.MustCompile(`^\[?title\]?\s*:\s*(.*\S)`)
 	matches := titleRegexp.FindStringSubmatch(string(firstLine))
 	var title string
 	if len(matches) > 1 {
@@ -388,12 +703,46 @@ func (dia *Diagram) ProcessData(data []byte) {
 		sliceData = sliceData[1:]
 		dia.SetTitle(title)
 	}
+	typeRegexp := regexp.MustCompile(`^\[?type\]?\s*:\s*(\w+)`)
+	if len(sliceData) > 0 {
+		if matches := typeRegexp.FindStringSubmatch(sliceData[0]); len(matches) > 1 {
+			dia.SetKind(matches[1])
+			sliceData = sliceData[1:]
+		}
+	}
+	switch dia.kind {
+	case ARCHITECTURE:
+		dia.processArchitecture(sliceData)
+		return
+	case ACTIVITY:
+		dia.processActivity(sliceData)
+		return
+	case TREE:
+		dia.processTree(sliceData)
+		return
+	case FLOWCHART:
+		dia.processFlowchart(sliceData)
+		return
+	}
 
 	relationRegexp := regexp.MustCompile(`^\[?([A-Za-z\s]+)\]?([-]+>{0,2})\[?([A-Za-z\s]+)\]?:?(.*)?`)
+	participantRegexp := regexp.MustCompile(`^participant\s+([A-Za-z][A-Za-z\s]*?)\s*(#\S+)?$`)
 	for _, line := range sliceData {
 		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//") {
 			continue
 		}
+		line, style := splitStyle(line)
+		if parts := participantRegexp.FindStringSubmatch(line); parts != nil {
+			if parts[2] != "" {
+				fill, err := styleColor(parts[2])
+				if err != nil {
+					log.Printf("%s: %s", line, err.Error())
+				}
+				style.Fill = fill
+			}
+			dia.SetElemenetStyle(parts[1], style)
+			continue
+		}
 		parts := relationRegexp.FindStringSubmatch(string(line))
 		if len(parts) > 4 {
 			fromElemenet := strings.Trim(parts[1], " ")
@@ -404,10 +753,14 @@ func (dia *Diagram) ProcessData(data []byte) {
 			if len(parts) == 5 && parts[4] != "" {
 				label = parts[4]
 			}
+			var err error
 			if relationType[len(relationType)-1] == '>' {
-				dia.AddDirectionalConnection(fromElemenet, toElemenet, label)
+				err = dia.AddDirectionalConnection(fromElemenet, toElemenet, label)
 			} else {
-				dia.AddConnection(fromElemenet, toElemenet, label)
+				err = dia.AddConnection(fromElemenet, toElemenet, label)
+			}
+			if err == nil {
+				dia.edges[len(dia.edges)-1].Style = style
 			}
 		}
 	}
@@ -0,0 +1,51 @@
+package zml
+
+import (
+	"fmt"
+	"sort"
+)
+
+// graphNode describes a node of a hierarchical diagram for comparison in
+// tests: its parent's ID, "" at the top level, its type and label
+type graphNode struct {
+	parent string
+	kind   int
+	label  string
+}
+
+// graphNodes returns the nodes of `dia` by ID
+func graphNodes(dia *Diagram) map[string]graphNode {
+	nodes := map[string]graphNode{}
+	for id, n := range dia.nodes {
+		parent := ""
+		if n.parent != dia.root {
+			parent = n.parent.ID
+		}
+		nodes[id] = graphNode{parent, n.Type, n.Label}
+	}
+	return nodes
+}
+
+// graphLinks returns the links of `dia` as "from -> to: label", with "--"
+// for links without an arrow, sorted
+func graphLinks(dia *Diagram) []string {
+	var links []string
+	for _, l := range dia.links {
+		arrow := "--"
+		if l.directional {
+			arrow = "->"
+		}
+		links = append(links, fmt.Sprintf("%s %s %s: %s", l.from.ID, arrow, l.to.ID, l.Label))
+	}
+	sort.Strings(links)
+	return links
+}
+
+// childIDs returns the IDs of the children of `n` in order
+func childIDs(n *node) []string {
+	var ids []string
+	for _, c := range n.children {
+		ids = append(ids, c.ID)
+	}
+	return ids
+}
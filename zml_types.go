@@ -7,18 +7,49 @@ const (
 	DECISION = 1
 	// CIRCLE sets elemenet type to circle
 	CIRCLE = 2
+	// SYSTEM sets elemenet type to a software system
+	SYSTEM = 3
+	// CONTAINER sets elemenet type to a container (app, service, data store)
+	CONTAINER = 4
+	// COMPONENT sets elemenet type to a component inside a container
+	COMPONENT = 5
+	// BOUNDARY sets elemenet type to a labeled group of other elemenets
+	BOUNDARY = 6
+	// FINAL sets elemenet type to an activity end circle
+	FINAL = 7
+	// BAR sets elemenet type to a fork/join bar
+	BAR = 8
+)
+
+const (
+	// SEQUENCE is the default diagram kind
+	SEQUENCE = "sequence"
+	// ARCHITECTURE renders systems, containers and components nested in boundaries
+	ARCHITECTURE = "architecture"
+	// ACTIVITY renders flowchart nodes in per-role swimlanes
+	ACTIVITY = "activity"
+	// TREE renders a hierarchy top-down, e.g. an org chart
+	TREE = "tree"
+	// FLOWCHART renders nodes and links, optionally grouped in subgraphs
+	FLOWCHART = "flowchart"
 )
 
 type elemenet struct {
-	Name string
-	Type int
+	Name  string
+	Type  int
+	Style Style
 }
 
-// Font font settings
+// Font font settings; Name is a family, e.g. "Noto Sans", or a .ttf/.otf
+// file and Style picks a face of the family, e.g. "bold italic". Fallback
+// lists more families or files, in order, for characters Name lacks such
+// as emoji or CJK.
 type Font struct {
-	Name  string
-	Size  float64
-	Color Color
+	Name     string
+	Style    string
+	Size     float64
+	Color    Color
+	Fallback []string
 }
 
 type edge struct {
@@ -26,6 +57,7 @@ type edge struct {
 	to          elemenet
 	directional bool
 	Label       string
+	Style       Style
 }
 
 func (e *edge) From() elemenet {
@@ -40,3 +72,34 @@ type elemenetCoord struct {
 	X float64
 	Y float64
 }
+
+// node is an elemenet of a hierarchical diagram; boundaries hold other nodes
+type node struct {
+	ID       string
+	Label    string
+	Type     int
+	Lane     string
+	parent   *node
+	children []*node
+
+	// set by the layout: x and y are relative to the parent until placeNode
+	// makes them absolute
+	x, y, w, h float64
+}
+
+func (n *node) isGroup() bool {
+	return n.Type == BOUNDARY || n.parent == nil
+}
+
+// link connects two nodes of a hierarchical diagram
+type link struct {
+	from        *node
+	to          *node
+	directional bool
+	Label       string
+}
+
+type point struct {
+	X float64
+	Y float64
+}